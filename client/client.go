@@ -12,4 +12,5 @@ import (
 type Client interface {
 	Write(ctx context.Context, in *model.WriteRequest, opts ...grpc.CallOption) (map[int64]*status.Status, error)
 	Init(authorization string, endpoint string, CAFileName string) error
+	Close(ctx context.Context) error
 }
@@ -21,16 +21,27 @@ func GetKey(plugin unsafe.Pointer, key string) string {
 	return strings.TrimSpace(output.FLBPluginConfigKey(plugin, key))
 }
 
-func GetDestination(getConfigValue func(string) string, metadataProvider metadata.Provider) (*model.Destination, error) {
+// GetDestination returns default destination, parseGroupID renders group_id
+// and reports whether it contains record keys resolved per entry.
+func GetDestination(getConfigValue func(string) string, metadataProvider metadata.Provider, parseGroupID func(string) (string, bool, error)) (*model.Destination, error) {
 	const (
 		keyFolderID         = "folder_id"
 		keyGroupID          = "group_id"
 		metadataKeyFolderID = "yandex/folder-id"
 	)
 
+	// group_id templated via record is resolved by plugin for each entry,
+	// folder is used as default destination in this case
+	groupTemplated := false
 	if groupID := getConfigValue(keyGroupID); len(groupID) > 0 {
-		groupID = metadata.Parse(groupID, metadataProvider)
-		return &model.Destination{LogGroupID: groupID}, nil
+		groupID, templated, err := parseGroupID(metadata.Parse(groupID, metadataProvider))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", keyGroupID, err.Error())
+		}
+		if !templated {
+			return &model.Destination{LogGroupID: groupID}, nil
+		}
+		groupTemplated = true
 	}
 
 	if folderID := getConfigValue(keyFolderID); len(folderID) > 0 {
@@ -40,6 +51,9 @@ func GetDestination(getConfigValue func(string) string, metadataProvider metadat
 
 	folderID, err := metadataProvider.GetValue(metadataKeyFolderID)
 	if err != nil {
+		if groupTemplated {
+			return nil, fmt.Errorf("no default destination for templated group_id, set folder_id: %s", err.Error())
+		}
 		return nil, err
 	}
 
@@ -111,6 +125,45 @@ func GetCAFileName(getConfigValue func(string) string) string {
 	return getConfigValue(CAFileNameKey)
 }
 
+func GetCompression(getConfigValue func(string) string) (string, error) {
+	const (
+		keyCompression  = "compression"
+		compressionNone = "none"
+	)
+
+	switch compression := strings.ToLower(getConfigValue(keyCompression)); compression {
+	case "", compressionNone:
+		return "", nil
+	case "gzip", "zstd":
+		return compression, nil
+	default:
+		return "", fmt.Errorf("unsupported compression %q", compression)
+	}
+}
+
+func GetHoistCommonFields(getConfigValue func(string) string) (bool, error) {
+	const keyHoistCommonFields = "hoist_common_fields"
+
+	hoist, err := ParseBool(getConfigValue(keyHoistCommonFields), false)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %s", keyHoistCommonFields, err.Error())
+	}
+	return hoist, nil
+}
+
+func ParseBool(value string, defaultValue bool) (bool, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return defaultValue, nil
+	case "true", "on", "yes", "1":
+		return true, nil
+	case "false", "off", "no", "0":
+		return false, nil
+	default:
+		return false, fmt.Errorf("expected boolean value, got %q", value)
+	}
+}
+
 func payloadFromString(payload string) (*structpb.Struct, error) {
 	result := new(structpb.Struct)
 	err := result.UnmarshalJSON([]byte(payload))
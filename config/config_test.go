@@ -1,6 +1,8 @@
 package config
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -19,6 +21,13 @@ var (
 		}
 		return ""
 	}
+	// parseGroupID treats values starting with brace as templated, plugin.ParseGroupID is tested in plugin
+	parseGroupID = func(value string) (string, bool, error) {
+		if strings.HasPrefix(value, "{}") {
+			return "", false, errors.New("empty key")
+		}
+		return value, strings.HasPrefix(value, "{"), nil
+	}
 )
 
 func TestGetDestination_GroupID_Success(t *testing.T) {
@@ -27,7 +36,7 @@ func TestGetDestination_GroupID_Success(t *testing.T) {
 	}
 	metadataProvider := test.MetadataProvider{}
 
-	destination, err := GetDestination(getConfigValue, metadataProvider)
+	destination, err := GetDestination(getConfigValue, metadataProvider, parseGroupID)
 
 	assert.Nil(t, err)
 	assert.Equal(t, &model.Destination{LogGroupID: "abcdef"}, destination)
@@ -41,7 +50,7 @@ func TestGetDestination_GroupIDTemplated_Success(t *testing.T) {
 		"group": "abcdef",
 	}
 
-	destination, err := GetDestination(getConfigValue, metadataProvider)
+	destination, err := GetDestination(getConfigValue, metadataProvider, parseGroupID)
 
 	assert.Nil(t, err)
 	assert.Equal(t, &model.Destination{LogGroupID: "abcdef"}, destination)
@@ -54,7 +63,7 @@ func TestGetDestination_GroupIDFolderID_Success(t *testing.T) {
 	}
 	metadataProvider := test.MetadataProvider{}
 
-	destination, err := GetDestination(getConfigValue, metadataProvider)
+	destination, err := GetDestination(getConfigValue, metadataProvider, parseGroupID)
 
 	assert.Nil(t, err)
 	assert.Equal(t, &model.Destination{LogGroupID: "abcdef"}, destination)
@@ -66,7 +75,7 @@ func TestGetDestination_FolderID_Success(t *testing.T) {
 	}
 	metadataProvider := test.MetadataProvider{}
 
-	destination, err := GetDestination(getConfigValue, metadataProvider)
+	destination, err := GetDestination(getConfigValue, metadataProvider, parseGroupID)
 
 	assert.Nil(t, err)
 	assert.Equal(t, &model.Destination{FolderID: "qwerty"}, destination)
@@ -80,7 +89,7 @@ func TestGetDestination_FolderIDTemplated_Success(t *testing.T) {
 		"folder": "qwerty",
 	}
 
-	destination, err := GetDestination(getConfigValue, metadataProvider)
+	destination, err := GetDestination(getConfigValue, metadataProvider, parseGroupID)
 
 	assert.Nil(t, err)
 	assert.Equal(t, &model.Destination{FolderID: "qwerty"}, destination)
@@ -92,7 +101,7 @@ func TestGetDestination_FolderIDAutoDetection_Success(t *testing.T) {
 		"yandex/folder-id": "folder-id",
 	}
 
-	destination, err := GetDestination(getConfigValue, metadataProvider)
+	destination, err := GetDestination(getConfigValue, metadataProvider, parseGroupID)
 
 	assert.Nil(t, err)
 	assert.Equal(t, &model.Destination{FolderID: "folder-id"}, destination)
@@ -102,7 +111,43 @@ func TestGetDestination_FolderIDAutoDetection_Fail(t *testing.T) {
 	configMap = map[string]string{}
 	metadataProvider := test.MetadataProvider{}
 
-	_, err := GetDestination(getConfigValue, metadataProvider)
+	_, err := GetDestination(getConfigValue, metadataProvider, parseGroupID)
+
+	assert.NotNil(t, err)
+}
+
+func TestGetDestination_GroupIDRecordTemplated_Success(t *testing.T) {
+	configMap = map[string]string{
+		"group_id":  "{kubernetes/namespace_name}",
+		"folder_id": "qwerty",
+	}
+	metadataProvider := test.MetadataProvider{}
+
+	destination, err := GetDestination(getConfigValue, metadataProvider, parseGroupID)
+
+	assert.Nil(t, err)
+	assert.Equal(t, &model.Destination{FolderID: "qwerty"}, destination)
+}
+
+func TestGetDestination_GroupIDRecordTemplatedNoFolder_Fail(t *testing.T) {
+	configMap = map[string]string{
+		"group_id": "{kubernetes/namespace_name}",
+	}
+	metadataProvider := test.MetadataProvider{}
+
+	_, err := GetDestination(getConfigValue, metadataProvider, parseGroupID)
+
+	assert.NotNil(t, err)
+}
+
+func TestGetDestination_GroupID_Fail(t *testing.T) {
+	configMap = map[string]string{
+		"group_id":  "{}",
+		"folder_id": "qwerty",
+	}
+	metadataProvider := test.MetadataProvider{}
+
+	_, err := GetDestination(getConfigValue, metadataProvider, parseGroupID)
 
 	assert.NotNil(t, err)
 }
@@ -183,3 +228,47 @@ func TestGetDefaults_Templated_Success(t *testing.T) {
 	assert.Equal(t, "INFO", defaults.Level)
 	assert.Equal(t, map[string]*structpb.Value{}, defaults.JSONPayload.Fields)
 }
+
+func TestGetCompression_Success(t *testing.T) {
+	for value, expected := range map[string]string{"": "", "none": "", "gzip": "gzip", "ZSTD": "zstd"} {
+		configMap = map[string]string{
+			"compression": value,
+		}
+
+		compression, err := GetCompression(getConfigValue)
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, compression)
+	}
+}
+
+func TestGetCompression_Fail(t *testing.T) {
+	configMap = map[string]string{
+		"compression": "lz4",
+	}
+
+	_, err := GetCompression(getConfigValue)
+
+	assert.NotNil(t, err)
+}
+
+func TestGetHoistCommonFields_Success(t *testing.T) {
+	configMap = map[string]string{
+		"hoist_common_fields": "On",
+	}
+
+	hoist, err := GetHoistCommonFields(getConfigValue)
+
+	assert.Nil(t, err)
+	assert.True(t, hoist)
+}
+
+func TestGetHoistCommonFields_Fail(t *testing.T) {
+	configMap = map[string]string{
+		"hoist_common_fields": "sometimes",
+	}
+
+	_, err := GetHoistCommonFields(getConfigValue)
+
+	assert.NotNil(t, err)
+}
@@ -7,8 +7,9 @@ import (
 )
 
 type WriteRequest struct {
-	Resource *Resource
-	Entries  []*Entry
+	Destination *Destination
+	Resource    *Resource
+	Entries     []*Entry
 }
 
 type Destination struct {
@@ -21,6 +22,14 @@ type Resource struct {
 	ID   string
 }
 
+// BatchKey identifies entries which can be written with a single WriteRequest.
+// Empty Destination means the client default one.
+type BatchKey struct {
+	Destination Destination
+	Resource    Resource
+	StreamName  string
+}
+
 type Entry struct {
 	Timestamp   time.Time
 	Level       string
@@ -0,0 +1,131 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// aimdController limits number of in-flight writes and batch size:
+// both are halved when writes are throttled with ResourceExhausted
+// and increased after a round of successful writes.
+type aimdController struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	inFlight int
+	// limit and batchSize are changed under mu and can be observed without it
+	limit     atomic.Int64
+	maxLimit  int
+	batchSize atomic.Int64
+	maxBatch  int
+	minBatch  int
+	successes int
+}
+
+const aimdBatchStep = 10
+
+func newAIMDController(maxLimit, maxBatch int) *aimdController {
+	c := &aimdController{
+		maxLimit: maxLimit,
+		maxBatch: maxBatch,
+		minBatch: aimdBatchStep,
+	}
+	c.limit.Store(int64(maxLimit))
+	c.batchSize.Store(int64(maxBatch))
+	if c.minBatch > maxBatch {
+		c.minBatch = maxBatch
+	}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// acquire blocks until number of in-flight writes is below the limit or ctx is done.
+func (c *aimdController) acquire(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.inFlight >= c.currentLimit() {
+		// wake up waiters when ctx is done, they check it before waiting again
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				c.mu.Lock()
+				c.cond.Broadcast()
+				c.mu.Unlock()
+			case <-done:
+			}
+		}()
+	}
+	for c.inFlight >= c.currentLimit() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.cond.Wait()
+	}
+	c.inFlight++
+	return nil
+}
+
+// release finishes write and adjusts the limits.
+func (c *aimdController) release(throttled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inFlight--
+	defer c.cond.Broadcast()
+
+	curLimit, curBatchSize := c.currentLimit(), c.currentBatchSize()
+	if throttled {
+		c.successes = 0
+		limit, batchSize := maxInt(1, curLimit/2), maxInt(c.minBatch, curBatchSize/2)
+		if limit != curLimit || batchSize != curBatchSize {
+			c.set(limit, batchSize)
+			fmt.Printf("yc-logging: throttled, decreasing concurrency to %d and batch size to %d\n", limit, batchSize)
+		}
+		return
+	}
+
+	c.successes++
+	if c.successes < curLimit {
+		return
+	}
+	c.successes = 0
+	limit, batchSize := minInt(c.maxLimit, curLimit+1), minInt(c.maxBatch, curBatchSize+aimdBatchStep)
+	if limit != curLimit || batchSize != curBatchSize {
+		c.set(limit, batchSize)
+		fmt.Printf("yc-logging: increasing concurrency to %d and batch size to %d\n", limit, batchSize)
+	}
+}
+
+// set changes limits, c.mu must be held.
+func (c *aimdController) set(limit, batchSize int) {
+	c.limit.Store(int64(limit))
+	c.batchSize.Store(int64(batchSize))
+}
+
+// currentLimit returns current number of allowed in-flight writes.
+func (c *aimdController) currentLimit() int {
+	return int(c.limit.Load())
+}
+
+func (c *aimdController) currentBatchSize() int {
+	return int(c.batchSize.Load())
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
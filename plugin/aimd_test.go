@@ -0,0 +1,133 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+func TestAIMDController_Success(t *testing.T) {
+	c := newAIMDController(8, 100)
+
+	c.acquire(context.Background())
+	c.release(true)
+	assert.Equal(t, 4, c.currentLimit())
+	assert.Equal(t, 50, c.currentBatchSize())
+
+	for i := 0; i < 10; i++ {
+		c.acquire(context.Background())
+		c.release(true)
+	}
+	assert.Equal(t, 1, c.currentLimit())
+	assert.Equal(t, 10, c.currentBatchSize())
+
+	// limit is increased after a round of successful writes
+	c.acquire(context.Background())
+	c.release(false)
+	assert.Equal(t, 2, c.currentLimit())
+	assert.Equal(t, 20, c.currentBatchSize())
+	c.acquire(context.Background())
+	c.release(false)
+	assert.Equal(t, 2, c.currentLimit())
+	c.acquire(context.Background())
+	c.release(false)
+	assert.Equal(t, 3, c.currentLimit())
+	assert.Equal(t, 30, c.currentBatchSize())
+
+	for i := 0; i < 100; i++ {
+		c.acquire(context.Background())
+		c.release(false)
+	}
+	assert.Equal(t, 8, c.currentLimit())
+	assert.Equal(t, 100, c.currentBatchSize())
+}
+
+func TestAIMDController_Acquire_Success(t *testing.T) {
+	c := newAIMDController(2, 100)
+	var inFlight, maxInFlight int32
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.acquire(context.Background())
+			cur := atomic.AddInt32(&inFlight, 1)
+			for {
+				prev := atomic.LoadInt32(&maxInFlight)
+				if cur <= prev || atomic.CompareAndSwapInt32(&maxInFlight, prev, cur) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			c.release(false)
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, maxInFlight, int32(2))
+}
+
+func TestAIMDController_AcquireCanceled_Fail(t *testing.T) {
+	c := newAIMDController(1, 100)
+	assert.Nil(t, c.acquire(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.acquire(ctx)
+	}()
+	cancel()
+
+	select {
+	case err := <-errs:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("acquire is not interrupted by canceled context")
+	}
+	// canceled acquire doesn't take the slot
+	c.release(false)
+	assert.Nil(t, c.acquire(context.Background()))
+}
+
+func TestIsThrottled_Success(t *testing.T) {
+	assert.True(t, isThrottled(nil, status.Error(codes.ResourceExhausted, "")))
+	assert.False(t, isThrottled(nil, status.Error(codes.Unavailable, "")))
+	assert.True(t, isThrottled(map[int64]*rpcstatus.Status{0: {Code: int32(codes.ResourceExhausted)}}, nil))
+	assert.False(t, isThrottled(map[int64]*rpcstatus.Status{0: {Code: int32(codes.InvalidArgument)}}, nil))
+	assert.False(t, isThrottled(nil, nil))
+}
+
+func TestWriteAll_AdaptiveConcurrency_Success(t *testing.T) {
+	var calls int32
+	client := &recordingClient{
+		write: func(req *model.WriteRequest) (map[int64]*rpcstatus.Status, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return nil, status.Error(codes.ResourceExhausted, "quota")
+			}
+			return nil, nil
+		},
+	}
+	plugin := Plugin{client: client, aimd: newAIMDController(4, 100)}
+	keyToEntries := map[model.BatchKey][]*model.Entry{
+		{}: makeEntries(100),
+	}
+
+	results, resCount := plugin.WriteAll(keyToEntries)
+	assert.Equal(t, 1, resCount)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(<-results))
+
+	results, resCount = plugin.WriteAll(keyToEntries)
+	assert.Equal(t, 2, resCount)
+	waitResults(t, results, resCount)
+}
@@ -0,0 +1,134 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fluent/fluent-bit-go/output"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+// asyncQueue decouples Fluent Bit engine from writes: flushed chunks are queued
+// and sent by background senders, which retry them on retriable errors.
+type asyncQueue struct {
+	chunks  chan map[model.BatchKey][]*model.Entry
+	senders int
+	// unsent receives chunks which weren't sent before sending was interrupted on exit
+	unsent func(map[model.BatchKey][]*model.Entry)
+
+	mu     sync.RWMutex
+	closed bool
+	// stop is closed on exit to interrupt sending
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+const (
+	asyncRetryMinDelay = time.Second
+	asyncRetryMaxDelay = 30 * time.Second
+)
+
+func newAsyncQueue(size, senders int) *asyncQueue {
+	return &asyncQueue{
+		chunks:  make(chan map[model.BatchKey][]*model.Entry, size),
+		senders: senders,
+		stop:    make(chan struct{}),
+	}
+}
+
+// start runs senders, send returns Fluent Bit flush result code.
+func (q *asyncQueue) start(send func(map[model.BatchKey][]*model.Entry) int, unsent func(map[model.BatchKey][]*model.Entry)) {
+	q.unsent = unsent
+	for i := 0; i < q.senders; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for chunk := range q.chunks {
+				sendWithRetry(chunk, send, q.stop, q.unsent)
+			}
+		}()
+	}
+}
+
+// sendWithRetry retries chunk with backoff while send returns FLB_RETRY,
+// chunk is passed to unsent when stop is closed before it's sent.
+func sendWithRetry(chunk map[model.BatchKey][]*model.Entry, send func(map[model.BatchKey][]*model.Entry) int,
+	stop <-chan struct{}, unsent func(map[model.BatchKey][]*model.Entry)) int {
+	delay := asyncRetryMinDelay
+	for {
+		select {
+		case <-stop:
+			unsent(chunk)
+			return output.FLB_RETRY
+		default:
+		}
+		code := send(chunk)
+		if code != output.FLB_RETRY {
+			return code
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-stop:
+			timer.Stop()
+			unsent(chunk)
+			return output.FLB_RETRY
+		case <-timer.C:
+		}
+		if delay *= 2; delay > asyncRetryMaxDelay {
+			delay = asyncRetryMaxDelay
+		}
+	}
+}
+
+// enqueue returns false if queue is full or closed.
+func (q *asyncQueue) enqueue(chunk map[model.BatchKey][]*model.Entry) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return false
+	}
+	select {
+	case q.chunks <- chunk:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops accepting chunks and waits until the queued ones are sent,
+// when ctx is done sending is interrupted and the rest of chunks are passed to unsent.
+func (q *asyncQueue) close(ctx context.Context) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.chunks)
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+	close(q.stop)
+	<-done
+}
+
+func countEntries(keyToEntries map[model.BatchKey][]*model.Entry) int {
+	count := 0
+	for _, entries := range keyToEntries {
+		count += len(entries)
+	}
+	return count
+}
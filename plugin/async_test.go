@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fluent/fluent-bit-go/output"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+func TestAsyncQueue_Success(t *testing.T) {
+	q := newAsyncQueue(2, 1)
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	var sent int32
+	q.start(func(chunk map[model.BatchKey][]*model.Entry) int {
+		started <- struct{}{}
+		<-release
+		atomic.AddInt32(&sent, int32(countEntries(chunk)))
+		return output.FLB_OK
+	}, func(map[model.BatchKey][]*model.Entry) {
+		t.Error("unexpected unsent chunk")
+	})
+	chunk := map[model.BatchKey][]*model.Entry{{}: makeEntries(3)}
+
+	assert.True(t, q.enqueue(chunk))
+	<-started
+	// sender is busy, so only queue size chunks fit
+	assert.True(t, q.enqueue(chunk))
+	assert.True(t, q.enqueue(chunk))
+	assert.False(t, q.enqueue(chunk))
+
+	close(release)
+	q.close(context.Background())
+
+	assert.Equal(t, int32(9), atomic.LoadInt32(&sent))
+	assert.False(t, q.enqueue(chunk))
+	q.close(context.Background())
+}
+
+func TestAsyncQueue_InterruptedOnClose_Success(t *testing.T) {
+	q := newAsyncQueue(2, 1)
+	var attempts int32
+	started := make(chan struct{}, 1)
+	var unsent []map[model.BatchKey][]*model.Entry
+	q.start(func(map[model.BatchKey][]*model.Entry) int {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			started <- struct{}{}
+		}
+		return output.FLB_RETRY
+	}, func(chunk map[model.BatchKey][]*model.Entry) {
+		unsent = append(unsent, chunk)
+	})
+
+	assert.True(t, q.enqueue(map[model.BatchKey][]*model.Entry{{}: makeEntries(1)}))
+	<-started
+	assert.True(t, q.enqueue(map[model.BatchKey][]*model.Entry{{}: makeEntries(2)}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	q.close(ctx)
+
+	// the first chunk is waiting for retry, the second one is not sent at all
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+	assert.Equal(t, 2, len(unsent))
+	assert.Equal(t, 2, countEntries(unsent[1]))
+}
+
+func TestFlush_Async_Success(t *testing.T) {
+	client := &recordingClient{}
+	plugin := Plugin{client: client, async: newAsyncQueue(4, 2), shutdownOpts: shutdownOptions{timeout: time.Minute}}
+	plugin.async.start(plugin.send, plugin.unsent)
+
+	for i := 0; i < 3; i++ {
+		code := plugin.Flush(map[model.BatchKey][]*model.Entry{
+			{Resource: model.Resource{ID: "1"}}: makeEntries(150),
+		})
+		assert.Equal(t, output.FLB_OK, code)
+	}
+	assert.Equal(t, output.FLB_OK, plugin.Flush(nil))
+	plugin.Close()
+
+	assert.Equal(t, 6, len(client.requests))
+	assert.Equal(t, output.FLB_RETRY, plugin.Flush(map[model.BatchKey][]*model.Entry{{}: makeEntries(1)}))
+}
@@ -1,10 +1,17 @@
 package plugin
 
 import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/config"
 	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/metadata"
 )
 
-func getParseKeys(getConfigValue func(string) string, metadataProvider metadata.Provider) *parseKeys {
+func getParseKeys(getConfigValue func(string) string, metadataProvider metadata.Provider) (*parseKeys, error) {
 	const (
 		keyLevelKey      = "level_key"
 		keyMessageKey    = "message_key"
@@ -12,22 +19,429 @@ func getParseKeys(getConfigValue func(string) string, metadataProvider metadata.
 		keyResourceType  = "resource_type"
 		keyResourceID    = "resource_id"
 		keySteamName     = "stream_name"
+		keyTimeKey       = "time_key"
+		keyTimeFormat    = "time_format"
+		keyTimeKeep      = "time_keep"
+
+		keyEventMetadataKey = "event_metadata_key"
+
+		keyOnTemplateError      = "on_template_error"
+		keyFallbackResourceType = "fallback_resource_type"
+		keyFallbackResourceID   = "fallback_resource_id"
+		keyFallbackStreamName   = "fallback_stream_name"
+
+		keyGroupID      = "group_id"
+		keyGroupIDByTag = "group_id_by_tag"
+
+		keyParseMessageJSON = "parse_message_json"
+		keyJSONMessageKey   = "json_message_key"
+		keyJSONLevelKey     = "json_level_key"
+
+		keyPayloadKey       = "payload_key"
+		keyPayloadMode      = "payload_mode"
+		keyPayloadSeparator = "payload_separator"
+		keyPayloadMaxDepth  = "payload_max_depth"
 	)
 
 	level := metadata.Parse(getConfigValue(keyLevelKey), metadataProvider)
 	message := metadata.Parse(getConfigValue(keyMessageKey), metadataProvider)
 	messageTag := metadata.Parse(getConfigValue(keyMessageTagKey), metadataProvider)
 
-	resourceType := metadata.Parse(getConfigValue(keyResourceType), metadataProvider)
-	resourceID := metadata.Parse(getConfigValue(keyResourceID), metadataProvider)
-	streamName := metadata.Parse(getConfigValue(keySteamName), metadataProvider)
+	resourceType, err := newTemplate(metadata.Parse(getConfigValue(keyResourceType), metadataProvider))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyResourceType, err.Error())
+	}
+	resourceID, err := newTemplate(metadata.Parse(getConfigValue(keyResourceID), metadataProvider))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyResourceID, err.Error())
+	}
+	streamName, err := newTemplate(metadata.Parse(getConfigValue(keySteamName), metadataProvider))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keySteamName, err.Error())
+	}
+
+	timeKey := metadata.Parse(getConfigValue(keyTimeKey), metadataProvider)
+	timeFormat, err := newTimeParser(metadata.Parse(getConfigValue(keyTimeFormat), metadataProvider))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyTimeFormat, err.Error())
+	}
+	timeKeep, err := config.ParseBool(getConfigValue(keyTimeKeep), false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyTimeKeep, err.Error())
+	}
+
+	onTemplateError := templateErrorPolicy(strings.ToLower(getConfigValue(keyOnTemplateError)))
+	switch onTemplateError {
+	case "":
+		onTemplateError = templateErrorDrop
+	case templateErrorDrop, templateErrorFallback, templateErrorKeepStatic:
+	default:
+		return nil, fmt.Errorf("invalid %s: %q", keyOnTemplateError, onTemplateError)
+	}
+
+	// group_id without record templates is used by client as default destination
+	groupID, err := newTemplate(metadata.Parse(getConfigValue(keyGroupID), metadataProvider))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyGroupID, err.Error())
+	}
+	if !groupID.isTemplated() {
+		groupID = nil
+	}
+	tagRoutes, err := parseTagRoutes(metadata.Parse(getConfigValue(keyGroupIDByTag), metadataProvider))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyGroupIDByTag, err.Error())
+	}
+
+	parseMessageJSON, err := config.ParseBool(getConfigValue(keyParseMessageJSON), false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyParseMessageJSON, err.Error())
+	}
+	// inner keys are the same as record ones by default
+	jsonMessage := message
+	if value := getConfigValue(keyJSONMessageKey); len(value) > 0 {
+		jsonMessage = metadata.Parse(value, metadataProvider)
+	}
+	jsonLevel := level
+	if value := getConfigValue(keyJSONLevelKey); len(value) > 0 {
+		jsonLevel = metadata.Parse(value, metadataProvider)
+	}
+
+	shape := payloadShape{
+		mode:      payloadMode(strings.ToLower(getConfigValue(keyPayloadMode))),
+		separator: getConfigValue(keyPayloadSeparator),
+	}
+	switch shape.mode {
+	case "", payloadAsIs:
+		shape.mode = payloadAsIs
+	case payloadFlatten:
+		if len(shape.separator) == 0 {
+			shape.separator = defaultFlattenSeparator
+		}
+	case payloadUnflatten:
+		if len(shape.separator) == 0 {
+			shape.separator = defaultUnflattenSeparator
+		}
+	default:
+		return nil, fmt.Errorf("invalid %s: %q", keyPayloadMode, shape.mode)
+	}
+	shape.maxDepth, err = parseNonNegativeInt(getConfigValue(keyPayloadMaxDepth), 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyPayloadMaxDepth, err.Error())
+	}
 
 	return &parseKeys{
 		level:        level,
 		message:      message,
 		messageTag:   messageTag,
-		resourceType: newTemplate(resourceType),
-		resourceID:   newTemplate(resourceID),
-		streamName:   newTemplate(streamName),
+		resourceType: resourceType,
+		resourceID:   resourceID,
+		streamName:   streamName,
+		timeKey:      timeKey,
+		timeFormat:   timeFormat,
+		timeKeep:     timeKeep,
+
+		eventMetadataKey: metadata.Parse(getConfigValue(keyEventMetadataKey), metadataProvider),
+
+		onTemplateError:      onTemplateError,
+		fallbackResourceType: metadata.Parse(getConfigValue(keyFallbackResourceType), metadataProvider),
+		fallbackResourceID:   metadata.Parse(getConfigValue(keyFallbackResourceID), metadataProvider),
+		fallbackStreamName:   metadata.Parse(getConfigValue(keyFallbackStreamName), metadataProvider),
+
+		groupID:   groupID,
+		tagRoutes: tagRoutes,
+
+		parseMessageJSON: parseMessageJSON,
+		jsonMessage:      jsonMessage,
+		jsonLevel:        jsonLevel,
+
+		payloadKey:   metadata.Parse(getConfigValue(keyPayloadKey), metadataProvider),
+		payloadShape: shape,
+	}, nil
+}
+
+func getRoutes(getConfigValue func(string) string, metadataProvider metadata.Provider, base *parseKeys) ([]*route, error) {
+	const keyRoutesFile = "routes_file"
+
+	fileName := metadata.Parse(getConfigValue(keyRoutesFile), metadataProvider)
+	if len(fileName) == 0 {
+		return nil, nil
+	}
+	return loadRoutes(fileName, base, metadataProvider)
+}
+
+type writeOptions struct {
+	// preserveOrder makes batches of the same destination and resource to be sent sequentially
+	preserveOrder bool
+}
+
+func getWriteOptions(getConfigValue func(string) string) (writeOptions, error) {
+	const keyPreserveOrder = "preserve_order"
+
+	var opts writeOptions
+	var err error
+	opts.preserveOrder, err = config.ParseBool(getConfigValue(keyPreserveOrder), false)
+	if err != nil {
+		return writeOptions{}, fmt.Errorf("invalid %s: %s", keyPreserveOrder, err.Error())
+	}
+	return opts, nil
+}
+
+func getValueEncoder(getConfigValue func(string) string) (valueEncoder, error) {
+	const (
+		keyBinaryEncoding   = "binary_encoding"
+		keyLargeIntAsString = "large_int_as_string"
+		keyIntAsStringKeys  = "int_as_string_keys"
+	)
+
+	var encoder valueEncoder
+	switch encoding := binaryEncoding(strings.ToLower(getConfigValue(keyBinaryEncoding))); encoding {
+	case "":
+		encoder.binary = binaryBase64
+	case binaryBase64, binaryHex, binaryLossyReplace:
+		encoder.binary = encoding
+	default:
+		return valueEncoder{}, fmt.Errorf("invalid %s: %q", keyBinaryEncoding, encoding)
+	}
+
+	largeInts, err := config.ParseBool(getConfigValue(keyLargeIntAsString), false)
+	if err != nil {
+		return valueEncoder{}, fmt.Errorf("invalid %s: %s", keyLargeIntAsString, err.Error())
+	}
+	encoder.largeInts = largeInts
+
+	for _, key := range strings.Fields(getConfigValue(keyIntAsStringKeys)) {
+		if encoder.intKeys == nil {
+			encoder.intKeys = make(map[string]bool)
+		}
+		encoder.intKeys[key] = true
+	}
+
+	return encoder, nil
+}
+
+func getRateLimiter(getConfigValue func(string) string) (*rateLimiter, error) {
+	const (
+		keyRateLimitEntries = "rate_limit_entries"
+		keyRateLimitBytes   = "rate_limit_bytes"
+		keyRateLimitMode    = "rate_limit_mode"
+
+		rateLimitModeWait  = "wait"
+		rateLimitModeRetry = "retry"
+	)
+
+	entriesPerSecond, err := parseRate(getConfigValue(keyRateLimitEntries))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyRateLimitEntries, err.Error())
+	}
+	bytesPerSecond, err := parseRate(getConfigValue(keyRateLimitBytes))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyRateLimitBytes, err.Error())
+	}
+	if entriesPerSecond == 0 && bytesPerSecond == 0 {
+		return nil, nil
+	}
+
+	wait := true
+	switch mode := strings.ToLower(getConfigValue(keyRateLimitMode)); mode {
+	case "", rateLimitModeWait:
+	case rateLimitModeRetry:
+		wait = false
+	default:
+		return nil, fmt.Errorf("invalid %s: %q", keyRateLimitMode, mode)
+	}
+
+	return newRateLimiter(entriesPerSecond, bytesPerSecond, wait), nil
+}
+
+func getAIMDController(getConfigValue func(string) string) (*aimdController, error) {
+	const (
+		keyAdaptiveConcurrency = "adaptive_concurrency"
+		keyMaxConcurrency      = "max_concurrency"
+		defaultMaxConcurrency  = 8
+	)
+
+	adaptive, err := config.ParseBool(getConfigValue(keyAdaptiveConcurrency), false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyAdaptiveConcurrency, err.Error())
+	}
+	if !adaptive {
+		return nil, nil
+	}
+
+	maxConcurrency, err := parsePositiveInt(getConfigValue(keyMaxConcurrency), defaultMaxConcurrency)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyMaxConcurrency, err.Error())
+	}
+
+	return newAIMDController(maxConcurrency, defaultBatchMaxLen), nil
+}
+
+func getAsyncQueue(getConfigValue func(string) string) (*asyncQueue, error) {
+	const (
+		keyAsync          = "async"
+		keyAsyncQueueSize = "async_queue_size"
+		keyAsyncSenders   = "async_senders"
+
+		defaultAsyncQueueSize = 16
+		defaultAsyncSenders   = 1
+	)
+
+	async, err := config.ParseBool(getConfigValue(keyAsync), false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyAsync, err.Error())
+	}
+	if !async {
+		return nil, nil
+	}
+
+	queueSize, err := parsePositiveInt(getConfigValue(keyAsyncQueueSize), defaultAsyncQueueSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyAsyncQueueSize, err.Error())
+	}
+	senders, err := parsePositiveInt(getConfigValue(keyAsyncSenders), defaultAsyncSenders)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", keyAsyncSenders, err.Error())
+	}
+
+	return newAsyncQueue(queueSize, senders), nil
+}
+
+func getMultiline(getConfigValue func(string) string) (*multiline, error) {
+	const (
+		keyMultilineStart        = "multiline_start"
+		keyMultilineContinue     = "multiline_continue"
+		keyMultilineFlushTimeout = "multiline_flush_timeout"
+
+		defaultMultilineFlushTimeout = time.Second
+	)
+
+	var patterns [2]*regexp.Regexp
+	for i, key := range []string{keyMultilineStart, keyMultilineContinue} {
+		value := getConfigValue(key)
+		if len(value) == 0 {
+			continue
+		}
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", key, err.Error())
+		}
+		patterns[i] = pattern
+	}
+	if patterns[0] == nil && patterns[1] == nil {
+		return nil, nil
+	}
+
+	timeout := defaultMultilineFlushTimeout
+	if value := getConfigValue(keyMultilineFlushTimeout); len(value) > 0 {
+		var err error
+		timeout, err = parseDuration(value)
+		if err != nil || timeout == 0 {
+			return nil, fmt.Errorf("invalid %s: expected positive duration, got %q", keyMultilineFlushTimeout, value)
+		}
+	}
+
+	return newMultiline(patterns[0], patterns[1], timeout), nil
+}
+
+type shutdownOptions struct {
+	// timeout limits waiting for in-flight writes on exit
+	timeout time.Duration
+	// spool keeps entries which weren't sent on exit, if configured
+	spool *spool
+}
+
+func getMessageLimit(getConfigValue func(string) string) (messageLimit, error) {
+	const (
+		keyMaxMessageBytes  = "max_message_bytes"
+		keyMaxMessagePolicy = "max_message_policy"
+	)
+
+	limit := messageLimit{policy: messageLimitPolicy(strings.ToLower(getConfigValue(keyMaxMessagePolicy)))}
+	if value := getConfigValue(keyMaxMessageBytes); len(value) > 0 {
+		maxBytes, err := strconv.Atoi(value)
+		if err != nil || maxBytes < 0 || (maxBytes > 0 && maxBytes < minMaxMessageBytes) {
+			return messageLimit{}, fmt.Errorf("invalid %s: expected 0 or integer >= %d, got %q", keyMaxMessageBytes, minMaxMessageBytes, value)
+		}
+		limit.maxBytes = maxBytes
+	}
+	switch limit.policy {
+	case "":
+		limit.policy = messageLimitTruncate
+	case messageLimitTruncate, messageLimitSplit:
+	default:
+		return messageLimit{}, fmt.Errorf("invalid %s: %q", keyMaxMessagePolicy, limit.policy)
+	}
+	return limit, nil
+}
+
+func getShutdownOptions(getConfigValue func(string) string, metadataProvider metadata.Provider) (shutdownOptions, error) {
+	const (
+		keyShutdownTimeout = "shutdown_timeout"
+		keySpoolDir        = "spool_dir"
+
+		defaultShutdownTimeout = 5 * time.Second
+	)
+
+	opts := shutdownOptions{timeout: defaultShutdownTimeout}
+	if value := getConfigValue(keyShutdownTimeout); len(value) > 0 {
+		timeout, err := parseDuration(value)
+		if err != nil {
+			return shutdownOptions{}, fmt.Errorf("invalid %s: %s", keyShutdownTimeout, err.Error())
+		}
+		opts.timeout = timeout
+	}
+
+	if dir := metadata.Parse(getConfigValue(keySpoolDir), metadataProvider); len(dir) > 0 {
+		s, err := newSpool(dir)
+		if err != nil {
+			return shutdownOptions{}, fmt.Errorf("invalid %s: %s", keySpoolDir, err.Error())
+		}
+		opts.spool = s
+	}
+	return opts, nil
+}
+
+// parseDuration accepts Go durations (i.e., 1m30s) and integer seconds.
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("expected non-negative duration, got %q", value)
+	}
+	return d, nil
+}
+
+func parsePositiveInt(value string, defaultValue int) (int, error) {
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("expected positive integer, got %q", value)
+	}
+	return n, nil
+}
+
+func parseNonNegativeInt(value string, defaultValue int) (int, error) {
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected non-negative integer, got %q", value)
+	}
+	return n, nil
+}
+
+func parseRate(value string) (float64, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 {
+		return 0, fmt.Errorf("expected non-negative number, got %q", value)
 	}
+	return rate, nil
 }
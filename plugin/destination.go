@@ -0,0 +1,80 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+// tagRoute chooses log group for entries with Fluent Bit tag matching pattern.
+type tagRoute struct {
+	pattern string
+	groupID *template
+}
+
+// destination returns empty destination, if entry should be written to the client default one.
+func (pk *parseKeys) destination(record, meta *structpb.Struct, tag string) (model.Destination, error) {
+	groupID := pk.groupID
+	for _, route := range pk.tagRoutes {
+		if matchTag(route.pattern, tag) {
+			groupID = route.groupID
+			break
+		}
+	}
+	if groupID == nil {
+		return model.Destination{}, nil
+	}
+
+	value, err := groupID.parse(record, meta)
+	if err == nil {
+		return model.Destination{LogGroupID: value}, nil
+	}
+	// partial log group ID doesn't exist, so keep_static falls back to default destination as well
+	switch pk.onTemplateError {
+	case templateErrorFallback, templateErrorKeepStatic:
+		return model.Destination{}, nil
+	default:
+		return model.Destination{}, err
+	}
+}
+
+// parseTagRoutes parses whitespace separated list of tag routes like "app.*=group1 sys.*={namespace}".
+func parseTagRoutes(raw string) ([]tagRoute, error) {
+	routes := make([]tagRoute, 0)
+	for _, field := range strings.Fields(raw) {
+		idx := strings.IndexByte(field, '=')
+		if idx <= 0 || idx == len(field)-1 {
+			return nil, fmt.Errorf("invalid route %q: expected tag_pattern=group_id", field)
+		}
+		groupID, err := newTemplate(field[idx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %q: %s", field, err.Error())
+		}
+		routes = append(routes, tagRoute{
+			pattern: field[:idx],
+			groupID: groupID,
+		})
+	}
+	return routes, nil
+}
+
+// matchTag matches Fluent Bit tag against pattern with '*' wildcards, like Fluent Bit Match does.
+func matchTag(pattern, tag string) bool {
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return pattern == tag
+	}
+	if !strings.HasPrefix(tag, pattern[:star]) {
+		return false
+	}
+	tag, pattern = tag[star:], pattern[star+1:]
+	for i := 0; i <= len(tag); i++ {
+		if matchTag(pattern, tag[i:]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+func TestMatchTag_Success(t *testing.T) {
+	tests := []struct {
+		pattern string
+		tag     string
+		matched bool
+	}{
+		{"*", "kube.var.log", true},
+		{"kube.*", "kube.var.log", true},
+		{"kube.*.log", "kube.var.log", true},
+		{"*.log", "kube.var.log", true},
+		{"kube.var.log", "kube.var.log", true},
+		{"kube.*", "app.var.log", false},
+		{"*.txt", "kube.var.log", false},
+		{"kube", "kube.var.log", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.matched, matchTag(tt.pattern, tt.tag), "%s %s", tt.pattern, tt.tag)
+	}
+}
+
+func TestParseTagRoutes_Success(t *testing.T) {
+	routes, err := parseTagRoutes("app.*=group1  sys.*={namespace}")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(routes))
+	assert.Equal(t, "app.*", routes[0].pattern)
+	assert.Equal(t, "sys.*", routes[1].pattern)
+	assert.True(t, routes[1].groupID.isTemplated())
+}
+
+func TestParseTagRoutes_Fail(t *testing.T) {
+	for _, raw := range []string{"app.*", "=group", "app.*=", "app.*={group|unknown}"} {
+		_, err := parseTagRoutes(raw)
+
+		assert.NotNil(t, err, raw)
+	}
+}
+
+func TestDestination_Success(t *testing.T) {
+	routes, _ := parseTagRoutes("app.*=app_group sys.*=sys_{namespace}")
+	pk := parseKeys{
+		groupID:   mustNewTemplate("{namespace}_group"),
+		tagRoutes: routes,
+	}
+	record := map[interface{}]interface{}{
+		"namespace": "default",
+	}
+
+	destination, err := pk.destination(toStruct(record), nil, "app.log")
+	assert.Nil(t, err)
+	assert.Equal(t, model.Destination{LogGroupID: "app_group"}, destination)
+
+	destination, err = pk.destination(toStruct(record), nil, "sys.log")
+	assert.Nil(t, err)
+	assert.Equal(t, model.Destination{LogGroupID: "sys_default"}, destination)
+
+	destination, err = pk.destination(toStruct(record), nil, "other.log")
+	assert.Nil(t, err)
+	assert.Equal(t, model.Destination{LogGroupID: "default_group"}, destination)
+}
+
+func TestDestination_Default_Success(t *testing.T) {
+	pk := parseKeys{}
+
+	destination, err := pk.destination(toStruct(map[interface{}]interface{}{}), nil, "tag")
+
+	assert.Nil(t, err)
+	assert.Equal(t, model.Destination{}, destination)
+}
+
+func TestDestination_Fallback_Success(t *testing.T) {
+	for _, onTemplateError := range []templateErrorPolicy{templateErrorFallback, templateErrorKeepStatic} {
+		pk := parseKeys{
+			groupID:         mustNewTemplate("grp-{namespace}"),
+			onTemplateError: onTemplateError,
+		}
+
+		destination, err := pk.destination(toStruct(map[interface{}]interface{}{}), nil, "tag")
+
+		assert.Nil(t, err, onTemplateError)
+		assert.Equal(t, model.Destination{}, destination, onTemplateError)
+	}
+}
+
+func TestDestination_Fail(t *testing.T) {
+	pk := parseKeys{
+		groupID: mustNewTemplate("{namespace}"),
+	}
+
+	_, err := pk.destination(toStruct(map[interface{}]interface{}{}), nil, "tag")
+
+	assert.NotNil(t, err)
+}
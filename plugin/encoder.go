@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// binaryEncoding defines how record values with non UTF-8 bytes are turned into strings,
+// the same encoding applies to payload, message and template values as they are all read from record.
+type binaryEncoding string
+
+const (
+	binaryBase64       binaryEncoding = "base64"
+	binaryHex          binaryEncoding = "hex"
+	binaryLossyReplace binaryEncoding = "lossy-replace"
+)
+
+// maxSafeInt is the largest integer float64 represents exactly along with all smaller ones.
+const maxSafeInt = 1 << 53
+
+// valueEncoder converts record values which structpb can't keep as is.
+// Plugin keeps configured encoder, its copy is used for a single chunk to count encoded values.
+// Nil encoder uses base64 and keeps all integers as numbers.
+type valueEncoder struct {
+	binary binaryEncoding
+	// binaryCount is number of values with non UTF-8 bytes
+	binaryCount int
+
+	// largeInts renders integers outside of float64 safe range as strings
+	largeInts bool
+	// intKeys are names of fields with integers rendered as strings, at any depth
+	intKeys map[string]bool
+}
+
+func (e *valueEncoder) bytes(b []byte) string {
+	if e == nil {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	e.binaryCount++
+	switch e.binary {
+	case binaryHex:
+		return hex.EncodeToString(b)
+	case binaryLossyReplace:
+		return strings.ToValidUTF8(string(b), string(utf8.RuneError))
+	default:
+		return base64.StdEncoding.EncodeToString(b)
+	}
+}
+
+// int returns value of integer in field, which is string if precision would be lost
+// or the field is listed in intKeys.
+func (e *valueEncoder) int(field string, v int64) *structpb.Value {
+	if e != nil && (e.intKeys[field] || e.largeInts && (v > maxSafeInt || v < -maxSafeInt)) {
+		return structpb.NewStringValue(strconv.FormatInt(v, 10))
+	}
+	return structpb.NewNumberValue(float64(v))
+}
+
+func (e *valueEncoder) uint(field string, v uint64) *structpb.Value {
+	if e != nil && (e.intKeys[field] || e.largeInts && v > maxSafeInt) {
+		return structpb.NewStringValue(strconv.FormatUint(v, 10))
+	}
+	return structpb.NewNumberValue(float64(v))
+}
@@ -0,0 +1,161 @@
+package plugin
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+func TestValueEncoder_Bytes_Success(t *testing.T) {
+	value := []byte{'o', 'k', 0xff, 0xfe}
+	tests := []struct {
+		encoding binaryEncoding
+		expected string
+	}{
+		{binaryBase64, "b2v//g=="},
+		{binaryHex, "6f6bfffe"},
+		{binaryLossyReplace, "ok�"},
+	}
+	for _, test := range tests {
+		enc := &valueEncoder{binary: test.encoding}
+
+		assert.Equal(t, test.expected, enc.bytes(value), test.encoding)
+		assert.Equal(t, 1, enc.binaryCount)
+	}
+	assert.Equal(t, "b2v//g==", (*valueEncoder)(nil).bytes(value))
+}
+
+func TestTransform_BinaryEncoding_Success(t *testing.T) {
+	record := map[string]interface{}{
+		"log":    []byte{0xd0, 0xbe, 0xd1}, // Cyrillic "о" followed by a cut character
+		"stream": []byte{0xff},
+		"nested": map[string]interface{}{"list": []interface{}{[]byte{0xfe}, "ok"}},
+		"valid":  []byte("строка"),
+	}
+	chunk := appendMsgpack(nil, []interface{}{uint64(1688206830), record})
+	tests := []struct {
+		encoding binaryEncoding
+		message  string
+		stream   string
+		nested   string
+	}{
+		{binaryBase64, "0L7R", "/w==", "/g=="},
+		{binaryHex, "d0bed1", "ff", "fe"},
+		{binaryLossyReplace, "о�", "�", "�"},
+	}
+	for _, test := range tests {
+		p := &Plugin{
+			keys: &parseKeys{
+				message:      "log",
+				resourceType: mustNewTemplate("type"),
+				resourceID:   mustNewTemplate("id"),
+				streamName:   mustNewTemplate("{stream}"),
+			},
+			encoder: valueEncoder{binary: test.encoding},
+		}
+
+		expected := transformGetRecord(p, chunk)
+		actual := p.TransformMsgpack(chunk, "tag")
+
+		assertSameEntries(t, expected, actual)
+		key := model.BatchKey{Resource: model.Resource{Type: "type", ID: "id"}, StreamName: test.stream}
+		assert.Equal(t, 1, len(actual[key]), test.encoding)
+		if len(actual[key]) == 0 {
+			continue
+		}
+		entry := actual[key][0]
+		assert.Equal(t, test.message, entry.Message)
+		assert.Equal(t, map[string]interface{}{
+			"stream": test.stream,
+			"nested": map[string]interface{}{"list": []interface{}{test.nested, "ok"}},
+			"valid":  "строка",
+		}, entry.JSONPayload.AsMap())
+		// 3 values are counted by each transform
+		assert.Equal(t, uint64(6), p.binaryFields.Load())
+	}
+}
+
+func TestValueEncoder_Int_Success(t *testing.T) {
+	enc := &valueEncoder{largeInts: true, intKeys: map[string]bool{"trace_id": true}}
+	tests := []struct {
+		field    string
+		value    int64
+		expected interface{}
+	}{
+		{"count", 1 << 53, float64(1 << 53)},
+		{"count", -1 << 53, float64(-1 << 53)},
+		{"count", 1<<53 + 1, "9007199254740993"},
+		{"count", -1<<53 - 1, "-9007199254740993"},
+		{"count", math.MaxInt64, "9223372036854775807"},
+		{"count", math.MinInt64, "-9223372036854775808"},
+		{"trace_id", 42, "42"},
+		{"trace_id", -42, "-42"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, enc.int(test.field, test.value).AsInterface(), test.value)
+	}
+
+	assert.Equal(t, float64(1<<53), enc.uint("count", 1<<53).AsInterface())
+	assert.Equal(t, "9007199254740993", enc.uint("count", 1<<53+1).AsInterface())
+	assert.Equal(t, "18446744073709551615", enc.uint("count", math.MaxUint64).AsInterface())
+	assert.Equal(t, "7", enc.uint("trace_id", 7).AsInterface())
+
+	// precision is lost by default
+	assert.Equal(t, float64(math.MaxInt64), (&valueEncoder{}).int("count", math.MaxInt64).AsInterface())
+	assert.Equal(t, float64(math.MaxUint64), (*valueEncoder)(nil).uint("trace_id", math.MaxUint64).AsInterface())
+}
+
+func TestTransform_LargeInts_Success(t *testing.T) {
+	record := map[string]interface{}{
+		"log":       "message",
+		"max_int":   int64(math.MaxInt64),
+		"min_int":   int64(math.MinInt64),
+		"max_uint":  uint64(math.MaxUint64),
+		"safe":      int64(1 << 53),
+		"negative":  int64(-42),
+		"float":     1.5,
+		"time":      int64(1688206830123456789),
+		"trace_ids": []interface{}{1, int64(-2), "x", 2.5},
+		"span":      map[string]interface{}{"trace_ids": 7, "other": 8},
+	}
+	chunk := appendMsgpack(nil, []interface{}{uint64(1688206830), record})
+	p := &Plugin{
+		keys: &parseKeys{
+			message:      "log",
+			resourceType: mustNewTemplate("type"),
+			resourceID:   mustNewTemplate("{max_uint}"),
+			streamName:   mustNewTemplate("stream"),
+			timeKey:      "time",
+			timeFormat:   unixParser(time.Nanosecond),
+			timeKeep:     true,
+		},
+		encoder: valueEncoder{largeInts: true, intKeys: map[string]bool{"trace_ids": true}},
+	}
+
+	expected := transformGetRecord(p, chunk)
+	actual := p.TransformMsgpack(chunk, "tag")
+
+	assertSameEntries(t, expected, actual)
+	key := model.BatchKey{Resource: model.Resource{Type: "type", ID: "18446744073709551615"}, StreamName: "stream"}
+	assert.Equal(t, 1, len(actual[key]))
+	if len(actual[key]) == 0 {
+		return
+	}
+	entry := actual[key][0]
+	assert.Equal(t, time.Unix(1688206830, 123456789), entry.Timestamp)
+	assert.Equal(t, map[string]interface{}{
+		"max_int":   "9223372036854775807",
+		"min_int":   "-9223372036854775808",
+		"max_uint":  "18446744073709551615",
+		"safe":      float64(1 << 53),
+		"negative":  float64(-42),
+		"float":     1.5,
+		"time":      "1688206830123456789",
+		"trace_ids": []interface{}{"1", "-2", "x", 2.5},
+		"span":      map[string]interface{}{"trace_ids": "7", "other": float64(8)},
+	}, entry.JSONPayload.AsMap())
+}
@@ -0,0 +1,124 @@
+package plugin
+
+import (
+	"io"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+// nextRecordProvider returns records the same way output.GetRecord does, so that tests
+// can build records as maps and check msgpackDecoder against transformRecords.
+type nextRecordProvider func() (ret int, ts interface{}, rec map[interface{}]interface{})
+
+// transformRecords is the reference implementation of TransformMsgpack on top of output.GetRecord.
+func (p *Plugin) transformRecords(provider nextRecordProvider, tag string) map[model.BatchKey][]*model.Entry {
+	enc := p.newEncoder()
+	return p.transform(func() (event, error) {
+		ret, rawTime, record := provider()
+		for ret == 0 && isGroupMarker(rawTime) {
+			ret, rawTime, record = provider()
+		}
+		if ret != 0 {
+			return event{}, io.EOF
+		}
+		return event{
+			time:   rawTime,
+			meta:   encodeStruct(eventMetadata(rawTime), enc),
+			record: encodeStruct(record, enc),
+		}, nil
+	}, enc, tag)
+}
+
+// toStruct converts test record without value encoder.
+func toStruct(record map[interface{}]interface{}) *structpb.Struct {
+	return encodeStruct(record, nil)
+}
+
+// encodeStruct converts record returned by output.GetRecord with enc, fields which structpb can't represent are dropped.
+func encodeStruct(record map[interface{}]interface{}, enc *valueEncoder) *structpb.Struct {
+	if record == nil {
+		return nil
+	}
+	fields := make(map[string]*structpb.Value, len(record))
+	for k, v := range record {
+		key, ok := mapKey(k)
+		if !ok {
+			continue
+		}
+		value, err := structpb.NewValue(normalize(v, key, enc))
+		if err != nil {
+			continue
+		}
+		fields[key] = value
+	}
+	return &structpb.Struct{Fields: fields}
+}
+
+// eventMetadata returns metadata of fluent-bit 2.1+ event group header, if present.
+func eventMetadata(raw interface{}) map[interface{}]interface{} {
+	header, ok := raw.([]interface{})
+	if !ok || len(header) < 2 {
+		return nil
+	}
+	metadata, _ := header[1].(map[interface{}]interface{})
+	return metadata
+}
+
+// normalize converts raw value of field to the form accepted by structpb.NewValue,
+// list elements are converted as values of the field, nested fields according to their own names.
+func normalize(raw interface{}, field string, enc *valueEncoder) interface{} {
+	switch typed := raw.(type) {
+	case []byte:
+		if utf8.Valid(typed) {
+			return string(typed)
+		}
+		return enc.bytes(typed)
+	case int:
+		return enc.int(field, int64(typed)).AsInterface()
+	case int64:
+		return enc.int(field, typed).AsInterface()
+	case uint64:
+		return enc.uint(field, typed).AsInterface()
+	case []interface{}:
+		if len(typed) == 0 {
+			return typed
+		}
+		valSlice := make([]interface{}, 0, len(typed))
+		for _, el := range typed {
+			valSlice = append(valSlice, normalize(el, field, enc))
+		}
+		return valSlice
+	case map[interface{}]interface{}:
+		if len(typed) == 0 {
+			if typed == nil {
+				return nil
+			}
+			return map[string]interface{}{}
+		}
+		valMap := make(map[string]interface{}, len(typed))
+		for key, val := range typed {
+			if keyStr, ok := mapKey(key); ok {
+				valMap[keyStr] = normalize(val, keyStr, enc)
+			}
+		}
+		return valMap
+	default:
+		return raw
+	}
+}
+
+// mapKey returns false for keys which aren't valid UTF-8 strings.
+func mapKey(raw interface{}) (string, bool) {
+	switch typed := raw.(type) {
+	case string:
+		return typed, true
+	case []byte:
+		if utf8.Valid(typed) {
+			return string(typed), true
+		}
+	}
+	return "", false
+}
@@ -9,6 +9,14 @@ import (
 	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
 )
 
+type templateErrorPolicy string
+
+const (
+	templateErrorDrop       templateErrorPolicy = "drop"
+	templateErrorFallback   templateErrorPolicy = "fallback"
+	templateErrorKeepStatic templateErrorPolicy = "keep_static"
+)
+
 type parseKeys struct {
 	level        string
 	message      string
@@ -16,9 +24,35 @@ type parseKeys struct {
 	resourceType *template
 	resourceID   *template
 	streamName   *template
+	timeKey      string
+	timeFormat   timeParser
+	timeKeep     bool
+
+	eventMetadataKey string
+
+	onTemplateError      templateErrorPolicy
+	fallbackResourceType string
+	fallbackResourceID   string
+	fallbackStreamName   string
+
+	groupID   *template
+	tagRoutes []tagRoute
+
+	defaultLevel string
+
+	// parseMessageJSON lifts fields of JSON object in message to payload,
+	// jsonMessage and jsonLevel are keys of message and level in it
+	parseMessageJSON bool
+	jsonMessage      string
+	jsonLevel        string
+
+	// payloadKey nests record fields under a single payload key
+	payloadKey   string
+	payloadShape payloadShape
 }
 
-func (pk *parseKeys) entry(ts time.Time, record map[interface{}]interface{}, tag string) (*model.Entry, model.Resource, error) {
+// entry reports problems which don't prevent writing the record to warnings.
+func (pk *parseKeys) entry(ts time.Time, record, meta *structpb.Struct, tag string, warnings *chunkWarnings) (*model.Entry, model.BatchKey, error) {
 	var message string
 	var level string
 
@@ -26,42 +60,83 @@ func (pk *parseKeys) entry(ts time.Time, record map[interface{}]interface{}, tag
 	if len(pk.messageTag) > 0 {
 		values[pk.messageTag] = structpb.NewStringValue(tag)
 	}
+	if len(pk.eventMetadataKey) > 0 && len(meta.GetFields()) > 0 {
+		values[pk.eventMetadataKey] = structpb.NewStructValue(meta)
+	}
 
-	resourceType, err := pk.resourceType.parse(record)
+	resourceType, err := pk.render(pk.resourceType, pk.fallbackResourceType, record, meta)
+	if err != nil {
+		return nil, model.BatchKey{}, fmt.Errorf("failed to parse resource type: %s", err.Error())
+	}
+	resourceID, err := pk.render(pk.resourceID, pk.fallbackResourceID, record, meta)
 	if err != nil {
-		return nil, model.Resource{}, fmt.Errorf("failed to parse resource type: %s", err.Error())
+		return nil, model.BatchKey{}, fmt.Errorf("failed to parse resource ID: %s", err.Error())
 	}
-	resourceID, err := pk.resourceID.parse(record)
+	streamName, err := pk.render(pk.streamName, pk.fallbackStreamName, record, meta)
 	if err != nil {
-		return nil, model.Resource{}, fmt.Errorf("failed to parse resource ID: %s", err.Error())
+		return nil, model.BatchKey{}, fmt.Errorf("failed to parse stream name: %s", err.Error())
 	}
-	streamName, err := pk.streamName.parse(record)
+	destination, err := pk.destination(record, meta, tag)
 	if err != nil {
-		return nil, model.Resource{}, fmt.Errorf("failed to parse stream name: %s", err.Error())
+		return nil, model.BatchKey{}, fmt.Errorf("failed to parse group ID: %s", err.Error())
 	}
-	resource := model.Resource{
-		Type: resourceType,
-		ID:   resourceID,
+	key := model.BatchKey{
+		Destination: destination,
+		Resource: model.Resource{
+			Type: resourceType,
+			ID:   resourceID,
+		},
+		StreamName: streamName,
 	}
 
-	for k, v := range record {
-		key, ok := k.(string)
-		if !ok {
+	timeParsed := false
+	if len(pk.timeKey) > 0 {
+		if raw, ok := record.GetFields()[pk.timeKey]; ok {
+			parsed, err := pk.timeFormat(raw.AsInterface())
+			if err != nil {
+				warnings.printf(warningTimeKey, "yc-logging: using event time for entries because of time parse error: %s\n", err.Error())
+			} else {
+				ts = parsed
+				timeParsed = true
+			}
+		}
+	}
+
+	// message tag and event metadata are kept at the top level of payload
+	fields := values
+	if len(pk.payloadKey) > 0 {
+		fields = make(map[string]*structpb.Value)
+	}
+	var messageJSON *structpb.Struct
+	for key, value := range record.GetFields() {
+		if timeParsed && !pk.timeKeep && key == pk.timeKey {
 			continue
 		}
 		switch key {
 		case pk.message:
-			message = toString(v)
+			message = valueString(value)
+			if pk.parseMessageJSON {
+				messageJSON = parseJSONObject(value)
+			}
 		case pk.level:
-			level = toString(v)
+			level = valueString(value)
 		default:
-			value, err := structpb.NewValue(normalize(v))
-			if err != nil {
-				continue
-			}
-			values[key] = value
+			fields[key] = value
 		}
 	}
+	if messageJSON != nil {
+		pk.liftMessageJSON(messageJSON, fields, &message, &level)
+	}
+	if len(level) == 0 {
+		level = pk.defaultLevel
+	}
+	if len(pk.payloadKey) > 0 {
+		if len(fields) > 0 {
+			values[pk.payloadKey] = structpb.NewStructValue(&structpb.Struct{Fields: pk.payloadShape.apply(fields)})
+		}
+	} else {
+		values = pk.payloadShape.apply(values)
+	}
 	var payload *structpb.Struct
 	if len(values) > 0 {
 		payload = &structpb.Struct{
@@ -74,5 +149,38 @@ func (pk *parseKeys) entry(ts time.Time, record map[interface{}]interface{}, tag
 		Message:     message,
 		JSONPayload: payload,
 		Timestamp:   ts,
-	}, resource, nil
+	}, key, nil
+}
+
+// liftMessageJSON adds fields of JSON object in message to payload fields, which take precedence over them.
+// Message and level are replaced with the inner ones if they are present, original message is kept otherwise.
+func (pk *parseKeys) liftMessageJSON(object *structpb.Struct, fields map[string]*structpb.Value, message, level *string) {
+	for key, value := range object.GetFields() {
+		switch {
+		case len(pk.jsonMessage) > 0 && key == pk.jsonMessage:
+			*message = valueString(value)
+		case len(pk.jsonLevel) > 0 && key == pk.jsonLevel:
+			*level = valueString(value)
+		default:
+			if _, ok := fields[key]; !ok {
+				fields[key] = value
+			}
+		}
+	}
+}
+
+// render applies on_template_error policy if template can't be parsed.
+func (pk *parseKeys) render(t *template, fallback string, record, meta *structpb.Struct) (string, error) {
+	value, err := t.parse(record, meta)
+	if err == nil {
+		return value, nil
+	}
+	switch pk.onTemplateError {
+	case templateErrorFallback:
+		return fallback, nil
+	case templateErrorKeepStatic:
+		return t.parseStatic(record, meta), nil
+	default:
+		return "", err
+	}
 }
@@ -1,6 +1,7 @@
 package plugin
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -14,9 +15,9 @@ func TestEntry_Success(t *testing.T) {
 		level:        "level",
 		message:      "message",
 		messageTag:   "tag_key",
-		resourceType: newTemplate("resource_type"),
-		resourceID:   newTemplate("resource_id"),
-		streamName:   newTemplate("stream_name"),
+		resourceType: mustNewTemplate("resource_type"),
+		resourceID:   mustNewTemplate("resource_id"),
+		streamName:   mustNewTemplate("stream_name"),
 	}
 	ts := time.Now()
 	record := map[interface{}]interface{}{
@@ -25,10 +26,10 @@ func TestEntry_Success(t *testing.T) {
 	}
 	tag := "tag"
 
-	entry, res, err := pk.entry(ts, record, tag)
+	entry, res, err := pk.entry(ts, toStruct(record), nil, tag, nil)
 
 	assert.Nil(t, err)
-	assert.Equal(t, model.Resource{Type: "resource_type", ID: "resource_id"}, res)
+	assert.Equal(t, model.Resource{Type: "resource_type", ID: "resource_id"}, res.Resource)
 	assert.Equal(t, "INFO", entry.Level)
 	assert.Equal(t, "record_message", entry.Message)
 	assert.Equal(t, ts, entry.Timestamp)
@@ -39,9 +40,9 @@ func TestEntry_Success(t *testing.T) {
 
 func TestEntry_TemplatedResource_Success(t *testing.T) {
 	pk := parseKeys{
-		resourceType: newTemplate("{simple}"),
-		resourceID:   newTemplate("resource_{json/path}"),
-		streamName:   newTemplate("stream_name"),
+		resourceType: mustNewTemplate("{simple}"),
+		resourceID:   mustNewTemplate("resource_{json/path}"),
+		streamName:   mustNewTemplate("stream_name"),
 	}
 	ts := time.Now()
 	record := map[interface{}]interface{}{
@@ -51,33 +52,33 @@ func TestEntry_TemplatedResource_Success(t *testing.T) {
 		},
 	}
 
-	_, res, err := pk.entry(ts, record, "")
+	_, res, err := pk.entry(ts, toStruct(record), nil, "", nil)
 
 	assert.Nil(t, err)
-	assert.Equal(t, model.Resource{Type: "resource_type", ID: "resource_id"}, res)
+	assert.Equal(t, model.Resource{Type: "resource_type", ID: "resource_id"}, res.Resource)
 }
 
 func TestEntry_TemplatedResourceID_Fail(t *testing.T) {
 	pk := parseKeys{
-		resourceType: newTemplate("{simple}"),
-		resourceID:   newTemplate("resource_{json/path}"),
-		streamName:   newTemplate("stream_name"),
+		resourceType: mustNewTemplate("{simple}"),
+		resourceID:   mustNewTemplate("resource_{json/path}"),
+		streamName:   mustNewTemplate("stream_name"),
 	}
 	ts := time.Now()
 	record := map[interface{}]interface{}{
 		"simple": "resource_type",
 	}
 
-	_, _, err := pk.entry(ts, record, "")
+	_, _, err := pk.entry(ts, toStruct(record), nil, "", nil)
 
 	assert.NotNil(t, err)
 }
 
 func TestEntry_TemplatedResourceType_Fail(t *testing.T) {
 	pk := parseKeys{
-		resourceType: newTemplate("{simple}"),
-		resourceID:   newTemplate("resource_{json/path}"),
-		streamName:   newTemplate("stream_name"),
+		resourceType: mustNewTemplate("{simple}"),
+		resourceID:   mustNewTemplate("resource_{json/path}"),
+		streamName:   mustNewTemplate("stream_name"),
 	}
 	ts := time.Now()
 	record := map[interface{}]interface{}{
@@ -86,7 +87,309 @@ func TestEntry_TemplatedResourceType_Fail(t *testing.T) {
 		},
 	}
 
-	_, _, err := pk.entry(ts, record, "")
+	_, _, err := pk.entry(ts, toStruct(record), nil, "", nil)
 
 	assert.NotNil(t, err)
 }
+
+func TestEntry_TimeKey_Success(t *testing.T) {
+	timeFormat, _ := newTimeParser("rfc3339")
+	pk := parseKeys{
+		resourceType: mustNewTemplate(""),
+		resourceID:   mustNewTemplate(""),
+		streamName:   mustNewTemplate(""),
+		timeKey:      "time",
+		timeFormat:   timeFormat,
+	}
+	record := map[interface{}]interface{}{
+		"time": "2023-07-01T10:20:30Z",
+		"name": "value",
+	}
+
+	entry, _, err := pk.entry(time.Now(), toStruct(record), nil, "", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2023, 7, 1, 10, 20, 30, 0, time.UTC), entry.Timestamp.UTC())
+	_, ok := entry.JSONPayload.AsMap()["time"]
+	assert.False(t, ok)
+}
+
+func TestEntry_TimeKeep_Success(t *testing.T) {
+	timeFormat, _ := newTimeParser("rfc3339")
+	pk := parseKeys{
+		resourceType: mustNewTemplate(""),
+		resourceID:   mustNewTemplate(""),
+		streamName:   mustNewTemplate(""),
+		timeKey:      "time",
+		timeFormat:   timeFormat,
+		timeKeep:     true,
+	}
+	record := map[interface{}]interface{}{
+		"time": "2023-07-01T10:20:30Z",
+	}
+
+	entry, _, err := pk.entry(time.Now(), toStruct(record), nil, "", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2023, 7, 1, 10, 20, 30, 0, time.UTC), entry.Timestamp.UTC())
+	assert.Equal(t, "2023-07-01T10:20:30Z", entry.JSONPayload.AsMap()["time"])
+}
+
+func TestEntry_TimeKeyInvalid_Fallback(t *testing.T) {
+	timeFormat, _ := newTimeParser("rfc3339")
+	pk := parseKeys{
+		resourceType: mustNewTemplate(""),
+		resourceID:   mustNewTemplate(""),
+		streamName:   mustNewTemplate(""),
+		timeKey:      "time",
+		timeFormat:   timeFormat,
+	}
+	ts := time.Now()
+	record := map[interface{}]interface{}{
+		"time": "yesterday",
+	}
+
+	entry, _, err := pk.entry(ts, toStruct(record), nil, "", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, ts, entry.Timestamp)
+	assert.Equal(t, "yesterday", entry.JSONPayload.AsMap()["time"])
+}
+
+func TestEntry_EventMetadataKey_Success(t *testing.T) {
+	pk := parseKeys{
+		resourceType:     mustNewTemplate(""),
+		resourceID:       mustNewTemplate(""),
+		streamName:       mustNewTemplate(""),
+		eventMetadataKey: "meta",
+	}
+	record := map[interface{}]interface{}{
+		"name": "value",
+	}
+	meta := map[interface{}]interface{}{
+		"otel": map[interface{}]interface{}{"trace_id": "abc"},
+	}
+
+	entry, _, err := pk.entry(time.Now(), toStruct(record), toStruct(meta), "", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"otel": map[string]interface{}{"trace_id": "abc"},
+	}, entry.JSONPayload.AsMap()["meta"])
+}
+
+func TestEntry_TemplatedMeta_Success(t *testing.T) {
+	pk := parseKeys{
+		resourceType: mustNewTemplate("resource_type"),
+		resourceID:   mustNewTemplate("{$meta/resource}"),
+		streamName:   mustNewTemplate("{$meta/otel/trace_id}"),
+	}
+	record := map[interface{}]interface{}{}
+	meta := map[interface{}]interface{}{
+		"resource": "resource_id",
+		"otel":     map[interface{}]interface{}{"trace_id": "abc"},
+	}
+
+	entry, res, err := pk.entry(time.Now(), toStruct(record), toStruct(meta), "", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, model.Resource{Type: "resource_type", ID: "resource_id"}, res.Resource)
+	assert.Equal(t, "abc", entry.StreamName)
+}
+
+func TestEntry_TemplateErrorFallback_Success(t *testing.T) {
+	pk := parseKeys{
+		resourceType:         mustNewTemplate("{simple}"),
+		resourceID:           mustNewTemplate("resource_{json/path}"),
+		streamName:           mustNewTemplate("{stream}"),
+		onTemplateError:      templateErrorFallback,
+		fallbackResourceType: "fallback_type",
+		fallbackResourceID:   "fallback_id",
+	}
+	record := map[interface{}]interface{}{
+		"simple": "resource_type",
+	}
+
+	entry, res, err := pk.entry(time.Now(), toStruct(record), nil, "", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, model.Resource{Type: "resource_type", ID: "fallback_id"}, res.Resource)
+	assert.Equal(t, "", entry.StreamName)
+}
+
+func TestEntry_TemplateErrorKeepStatic_Success(t *testing.T) {
+	pk := parseKeys{
+		resourceType:    mustNewTemplate("{simple}"),
+		resourceID:      mustNewTemplate("resource_{json/path}"),
+		streamName:      mustNewTemplate("stream_{stream}"),
+		onTemplateError: templateErrorKeepStatic,
+	}
+	record := map[interface{}]interface{}{
+		"simple": "resource_type",
+	}
+
+	entry, res, err := pk.entry(time.Now(), toStruct(record), nil, "", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, model.Resource{Type: "resource_type", ID: "resource_"}, res.Resource)
+	assert.Equal(t, "stream_", entry.StreamName)
+}
+
+func TestEntry_PayloadKey_Success(t *testing.T) {
+	pk := parseKeys{
+		level:            "level",
+		message:          "message",
+		messageTag:       "tag_key",
+		resourceType:     mustNewTemplate(""),
+		resourceID:       mustNewTemplate(""),
+		streamName:       mustNewTemplate(""),
+		timeKey:          "time",
+		timeFormat:       unixParser(time.Second),
+		timeKeep:         true,
+		eventMetadataKey: "meta",
+		payloadKey:       "fields",
+		payloadShape:     payloadShape{mode: payloadFlatten, separator: "_"},
+	}
+	record := map[interface{}]interface{}{
+		"level":   "INFO",
+		"message": "record_message",
+		"time":    1688206830,
+		"tag_key": "record_tag",
+		"http":    map[interface{}]interface{}{"status": 200},
+	}
+	meta := map[interface{}]interface{}{"otel": "abc"}
+
+	entry, _, err := pk.entry(time.Now(), toStruct(record), toStruct(meta), "tag", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "INFO", entry.Level)
+	assert.Equal(t, "record_message", entry.Message)
+	assert.Equal(t, time.Unix(1688206830, 0), entry.Timestamp)
+	// record fields don't collide with message tag and event metadata
+	assert.Equal(t, map[string]interface{}{
+		"tag_key": "tag",
+		"meta":    map[string]interface{}{"otel": "abc"},
+		"fields": map[string]interface{}{
+			"time":        float64(1688206830),
+			"tag_key":     "record_tag",
+			"http_status": float64(200),
+		},
+	}, entry.JSONPayload.AsMap())
+
+	// payload key is omitted for record without other fields
+	entry, _, err = pk.entry(time.Now(), toStruct(map[interface{}]interface{}{"message": "only"}), nil, "tag", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"tag_key": "tag"}, entry.JSONPayload.AsMap())
+}
+
+func TestEntry_ParseMessageJSON_Success(t *testing.T) {
+	pk := parseKeys{
+		level:            "level",
+		message:          "log",
+		resourceType:     mustNewTemplate(""),
+		resourceID:       mustNewTemplate(""),
+		streamName:       mustNewTemplate(""),
+		parseMessageJSON: true,
+		jsonMessage:      "msg",
+		jsonLevel:        "severity",
+	}
+	record := map[interface{}]interface{}{
+		"log":    ` {"msg": "connected", "severity": "WARN", "http": {"status": 200}, "stream": "inner"} `,
+		"level":  "INFO",
+		"stream": "stdout",
+	}
+
+	entry, _, err := pk.entry(time.Now(), toStruct(record), nil, "", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "connected", entry.Message)
+	assert.Equal(t, "WARN", entry.Level)
+	// record fields take precedence over the lifted ones
+	assert.Equal(t, map[string]interface{}{
+		"http":   map[string]interface{}{"status": float64(200)},
+		"stream": "stdout",
+	}, entry.JSONPayload.AsMap())
+
+	// lifted fields are nested with the record ones, outer level is kept without inner one
+	pk.payloadKey = "fields"
+	record["log"] = `{"msg": "connected", "user": "root"}`
+	entry, _, err = pk.entry(time.Now(), toStruct(record), nil, "", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "connected", entry.Message)
+	assert.Equal(t, "INFO", entry.Level)
+	assert.Equal(t, map[string]interface{}{
+		"fields": map[string]interface{}{"stream": "stdout", "user": "root"},
+	}, entry.JSONPayload.AsMap())
+
+	// original message is kept if the object has no inner one
+	pk.payloadKey = ""
+	record["log"] = `{"user": "root", "severity": "ERROR"}`
+	entry, _, err = pk.entry(time.Now(), toStruct(record), nil, "", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `{"user": "root", "severity": "ERROR"}`, entry.Message)
+	assert.Equal(t, "ERROR", entry.Level)
+	assert.Equal(t, map[string]interface{}{"stream": "stdout", "user": "root"}, entry.JSONPayload.AsMap())
+}
+
+func TestEntry_ParseMessageJSON_Fallback(t *testing.T) {
+	pk := parseKeys{
+		message:          "log",
+		resourceType:     mustNewTemplate(""),
+		resourceID:       mustNewTemplate(""),
+		streamName:       mustNewTemplate(""),
+		parseMessageJSON: true,
+		jsonMessage:      "log",
+	}
+	for _, raw := range []interface{}{
+		"plain text",
+		`{"unterminated": `,
+		`["array"]`,
+		`"string"`,
+		"{broken} text",
+	} {
+		record := map[interface{}]interface{}{"log": raw}
+
+		entry, _, err := pk.entry(time.Now(), toStruct(record), nil, "", nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, raw, entry.Message)
+		assert.Nil(t, entry.JSONPayload)
+	}
+
+	// message which isn't a string is not parsed
+	entry, _, err := pk.entry(time.Now(), toStruct(map[interface{}]interface{}{
+		"log": map[interface{}]interface{}{"log": "inner"},
+	}), nil, "", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `{"log":"inner"}`, entry.Message)
+	assert.Nil(t, entry.JSONPayload)
+}
+
+func TestTransform_TimeKeyInvalid_WarnOnce(t *testing.T) {
+	p := &Plugin{
+		keys: &parseKeys{
+			resourceType: mustNewTemplate(""),
+			resourceID:   mustNewTemplate(""),
+			streamName:   mustNewTemplate(""),
+			timeKey:      "time",
+			timeFormat:   unixParser(time.Second),
+		},
+	}
+	var chunk []byte
+	for i := 0; i < 3; i++ {
+		chunk = appendMsgpack(chunk, []interface{}{uint64(1688206830), map[string]interface{}{"time": "invalid"}})
+	}
+
+	var keyToEntries map[model.BatchKey][]*model.Entry
+	out := captureStdout(t, func() {
+		keyToEntries = p.TransformMsgpack(chunk, "tag")
+		p.TransformMsgpack(chunk, "tag")
+	})
+
+	assert.Equal(t, 3, len(keyToEntries[model.BatchKey{}]))
+	assert.Equal(t, 2, strings.Count(out, "time parse error"))
+}
@@ -0,0 +1,114 @@
+package plugin
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+type messageLimitPolicy string
+
+const (
+	messageLimitTruncate messageLimitPolicy = "truncate"
+	messageLimitSplit    messageLimitPolicy = "split"
+)
+
+// payload fields added to entries with messages exceeding max_message_bytes
+const (
+	messageOriginalBytesKey = "message_original_bytes"
+	splitIDKey              = "split_id"
+	splitSeqKey             = "split_seq"
+	splitCountKey           = "split_count"
+)
+
+// minMaxMessageBytes allows any UTF-8 character to fit into the message.
+const minMaxMessageBytes = utf8.UTFMax
+
+// messageLimit applies max_message_bytes to entries before they are sent.
+type messageLimit struct {
+	// maxBytes is not limited if 0
+	maxBytes int
+	policy   messageLimitPolicy
+}
+
+// apply truncates or splits entries with messages longer than maxBytes, keeping order of entries.
+func (l messageLimit) apply(keyToEntries map[model.BatchKey][]*model.Entry) map[model.BatchKey][]*model.Entry {
+	if l.maxBytes <= 0 {
+		return keyToEntries
+	}
+	limited := make(map[model.BatchKey][]*model.Entry, len(keyToEntries))
+	for key, entries := range keyToEntries {
+		result := make([]*model.Entry, 0, len(entries))
+		for _, e := range entries {
+			switch {
+			case len(e.Message) <= l.maxBytes:
+				result = append(result, e)
+			case l.policy == messageLimitSplit:
+				result = append(result, splitMessage(e, l.maxBytes)...)
+			default:
+				result = append(result, truncateMessage(e, l.maxBytes))
+			}
+		}
+		limited[key] = result
+	}
+	return limited
+}
+
+// truncateMessage cuts message to maxBytes at character boundary and records original length in payload.
+func truncateMessage(entry *model.Entry, maxBytes int) *model.Entry {
+	originalBytes := len(entry.Message)
+	entry.Message, _ = cutUTF8(entry.Message, maxBytes)
+	setPayloadField(entry, messageOriginalBytesKey, structpb.NewNumberValue(float64(originalBytes)))
+	return entry
+}
+
+// splitMessage returns copies of entry with consecutive parts of the message, sharing split ID.
+func splitMessage(entry *model.Entry, maxBytes int) []*model.Entry {
+	parts := make([]string, 0, len(entry.Message)/maxBytes+1)
+	for rest := entry.Message; len(rest) > 0; {
+		var part string
+		part, rest = cutUTF8(rest, maxBytes)
+		parts = append(parts, part)
+	}
+
+	id := newSplitID()
+	entries := make([]*model.Entry, len(parts))
+	for i, part := range parts {
+		e := *entry
+		e.Message = part
+		e.JSONPayload = copyPayload(entry.JSONPayload)
+		setPayloadField(&e, splitIDKey, structpb.NewStringValue(id))
+		setPayloadField(&e, splitSeqKey, structpb.NewNumberValue(float64(i+1)))
+		setPayloadField(&e, splitCountKey, structpb.NewNumberValue(float64(len(parts))))
+		entries[i] = &e
+	}
+	return entries
+}
+
+func setPayloadField(entry *model.Entry, key string, value *structpb.Value) {
+	if entry.JSONPayload == nil {
+		entry.JSONPayload = &structpb.Struct{}
+	}
+	if entry.JSONPayload.Fields == nil {
+		entry.JSONPayload.Fields = make(map[string]*structpb.Value)
+	}
+	entry.JSONPayload.Fields[key] = value
+}
+
+// copyPayload copies top level fields only, values are shared.
+func copyPayload(payload *structpb.Struct) *structpb.Struct {
+	if payload == nil {
+		return nil
+	}
+	return &structpb.Struct{Fields: copyFields(payload.Fields)}
+}
+
+func newSplitID() string {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
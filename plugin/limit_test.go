@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fluent/fluent-bit-go/output"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/test"
+)
+
+func TestTruncateMessage_Success(t *testing.T) {
+	entry := &model.Entry{Message: "ошибка подключения"}
+
+	truncated := truncateMessage(entry, 11)
+
+	assert.Equal(t, "ошибк", truncated.Message)
+	assert.Equal(t, float64(len("ошибка подключения")), truncated.JSONPayload.AsMap()[messageOriginalBytesKey])
+}
+
+func TestSplitMessage_Success(t *testing.T) {
+	payload, _ := structpb.NewStruct(map[string]interface{}{"app": "api"})
+	ts := time.Unix(1688206830, 0)
+	message := strings.Repeat("я", 9) + "😀"
+	entry := &model.Entry{Timestamp: ts, Level: "ERROR", StreamName: "s", Message: message, JSONPayload: payload}
+
+	entries := splitMessage(entry, 8)
+
+	assert.Equal(t, 3, len(entries))
+	var joined strings.Builder
+	id := entries[0].JSONPayload.AsMap()[splitIDKey]
+	assert.NotEmpty(t, id)
+	for i, e := range entries {
+		assert.LessOrEqual(t, len(e.Message), 8)
+		assert.True(t, utf8.ValidString(e.Message))
+		joined.WriteString(e.Message)
+
+		fields := e.JSONPayload.AsMap()
+		assert.Equal(t, id, fields[splitIDKey])
+		assert.Equal(t, float64(i+1), fields[splitSeqKey])
+		assert.Equal(t, float64(3), fields[splitCountKey])
+		assert.Equal(t, "api", fields["app"])
+		assert.Equal(t, ts, e.Timestamp)
+		assert.Equal(t, "ERROR", e.Level)
+		assert.Equal(t, "s", e.StreamName)
+	}
+	assert.Equal(t, message, joined.String())
+	// original payload is not modified
+	assert.Equal(t, map[string]interface{}{"app": "api"}, payload.AsMap())
+	assert.NotEqual(t, id, splitMessage(entry, 8)[0].JSONPayload.AsMap()[splitIDKey])
+}
+
+func TestMessageLimit_Success(t *testing.T) {
+	limit := messageLimit{maxBytes: 4, policy: messageLimitTruncate}
+	key := model.BatchKey{StreamName: "s"}
+
+	limited := limit.apply(map[model.BatchKey][]*model.Entry{key: messageEntries("123456789", "1234")})
+	assert.Equal(t, []string{"1234", "1234"}, messages(limited[key]))
+	assert.Nil(t, limited[key][1].JSONPayload)
+
+	limit.policy = messageLimitSplit
+	limited = limit.apply(map[model.BatchKey][]*model.Entry{key: messageEntries("123456789", "1234")})
+	assert.Equal(t, []string{"1234", "5678", "9", "1234"}, messages(limited[key]))
+
+	unlimited := map[model.BatchKey][]*model.Entry{key: messageEntries("123456789")}
+	assert.Equal(t, unlimited, messageLimit{}.apply(unlimited))
+}
+
+func TestFlush_MultilineMaxMessageBytes_Success(t *testing.T) {
+	configMap = map[string]string{
+		"multiline_start":    `^\S`,
+		"max_message_bytes":  "8",
+		"max_message_policy": "split",
+	}
+	client := &recordingClient{}
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, client)
+	assert.Nil(t, err)
+
+	// parts of long lines aren't joined, the joined message is split as a whole
+	assert.Equal(t, output.FLB_OK, plugin.Flush(map[model.BatchKey][]*model.Entry{{}: messageEntries("first line", " second")}))
+	plugin.Close()
+
+	assert.Equal(t, 1, client.requestCount())
+	entries := client.requests[0].Entries
+	assert.Equal(t, []string{"first li", "ne\n seco", "nd"}, messages(entries))
+	for _, e := range entries {
+		assert.Equal(t, float64(3), e.JSONPayload.AsMap()[splitCountKey])
+	}
+}
@@ -0,0 +1,447 @@
+package plugin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fluent/fluent-bit-go/output"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// event is a single Fluent Bit record with its header.
+type event struct {
+	// time is raw event time in one of the formats supported by toTime
+	time   interface{}
+	meta   *structpb.Struct
+	record *structpb.Struct
+}
+
+// msgpackDecoder reads Fluent Bit chunk straight into protobuf values,
+// skipping intermediate map[interface{}]interface{} produced by output.GetRecord.
+// Results are the same as of output.GetRecord path kept in tests: strings and integers are converted
+// with value encoder, values which structpb can't represent (extensions inside record) make the enclosing top level field to be dropped.
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+	enc  *valueEncoder
+	// field is name of the innermost field being decoded
+	field string
+
+	// invalid is set when the value being decoded can't be represented by structpb
+	invalid bool
+}
+
+const flbTimeExtType = 0
+
+var errMsgpackShort = errors.New("unexpected end of data")
+
+func newMsgpackDecoder(data []byte, enc *valueEncoder) *msgpackDecoder {
+	return &msgpackDecoder{data: data, enc: enc}
+}
+
+// next returns io.EOF when all events are read, event group markers are skipped.
+func (d *msgpackDecoder) next() (event, error) {
+	for {
+		ev, err := d.event()
+		if err != nil || !isGroupMarker(ev.time) {
+			return ev, err
+		}
+	}
+}
+
+func (d *msgpackDecoder) event() (event, error) {
+	if d.pos >= len(d.data) {
+		return event{}, io.EOF
+	}
+
+	n, err := d.arrayLen()
+	if err != nil {
+		return event{}, err
+	}
+	if n != 2 {
+		return event{}, fmt.Errorf("invalid event: expected array of 2 elements, got %d", n)
+	}
+
+	var ev event
+	if d.peekArray() {
+		// fluent-bit 2.1+ event group header: [[time, metadata], record]
+		n, err := d.arrayLen()
+		if err != nil {
+			return event{}, err
+		}
+		if n < 1 {
+			return event{}, errors.New("invalid event: empty header")
+		}
+		ts, err := d.time()
+		if err != nil {
+			return event{}, err
+		}
+		header := []interface{}{ts}
+		for i := 1; i < n; i++ {
+			value, err := d.value()
+			if err != nil {
+				return event{}, err
+			}
+			if i == 1 {
+				ev.meta = value.GetStructValue()
+			}
+			d.invalid = false
+		}
+		ev.time = header
+	} else {
+		ts, err := d.time()
+		if err != nil {
+			return event{}, err
+		}
+		ev.time = ts
+	}
+
+	record, err := d.value()
+	if err != nil {
+		return event{}, err
+	}
+	d.invalid = false
+	if _, ok := record.GetKind().(*structpb.Value_StructValue); !ok {
+		return event{}, errors.New("invalid event: record is not a map")
+	}
+	ev.record = record.GetStructValue()
+	return ev, nil
+}
+
+func (d *msgpackDecoder) peekArray() bool {
+	if d.pos >= len(d.data) {
+		return false
+	}
+	c := d.data[d.pos]
+	return c&0xf0 == 0x90 || c == 0xdc || c == 0xdd
+}
+
+func (d *msgpackDecoder) arrayLen() (int, error) {
+	c, err := d.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case c&0xf0 == 0x90:
+		return int(c & 0x0f), nil
+	case c == 0xdc:
+		return d.uint(2)
+	case c == 0xdd:
+		return d.uint(4)
+	default:
+		return 0, fmt.Errorf("invalid event: expected array, got 0x%02x", c)
+	}
+}
+
+// time reads event time as it's returned by output.GetRecord.
+func (d *msgpackDecoder) time() (interface{}, error) {
+	c, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		// negative fixint, i.e. event group markers
+		return int64(int8(c)), nil
+	case c == 0xcc, c == 0xcd, c == 0xce, c == 0xcf:
+		b, err := d.bytes(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return readUint(b), nil
+	case c == 0xd0, c == 0xd1, c == 0xd2, c == 0xd3:
+		b, err := d.bytes(1 << (c - 0xd0))
+		if err != nil {
+			return nil, err
+		}
+		return readInt(b), nil
+	case c == 0xca, c == 0xcb:
+		return d.float(c)
+	case c == 0xd7, c == 0xc7:
+		start := d.pos - 1
+		n := 8
+		if c == 0xc7 {
+			if n, err = d.uint(1); err != nil {
+				return nil, err
+			}
+		}
+		b, err := d.bytes(1 + n)
+		if err != nil {
+			return nil, err
+		}
+		if n != 8 || int8(b[0]) != flbTimeExtType {
+			// other extensions are skipped and left to toTime to report, so that only this event is affected
+			d.pos = start
+			value, err := d.value()
+			d.invalid = false
+			return value, err
+		}
+		sec := binary.BigEndian.Uint32(b[1:])
+		nsec := binary.BigEndian.Uint32(b[5:])
+		return output.FLBTime{Time: time.Unix(int64(sec), int64(nsec))}, nil
+	default:
+		// leave it to toTime to report
+		d.pos--
+		return d.value()
+	}
+}
+
+func (d *msgpackDecoder) value() (*structpb.Value, error) {
+	c, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c <= 0x7f:
+		return d.enc.uint(d.field, uint64(c)), nil
+	case c >= 0xe0:
+		return d.enc.int(d.field, int64(int8(c))), nil
+	case c&0xf0 == 0x80:
+		return d.mapValue(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.listValue(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return d.stringValue(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return structpb.NewNullValue(), nil
+	case 0xc2:
+		return structpb.NewBoolValue(false), nil
+	case 0xc3:
+		return structpb.NewBoolValue(true), nil
+	case 0xd9, 0xda, 0xdb, 0xc4, 0xc5, 0xc6:
+		size, _ := stringLenSize(c)
+		n, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		return d.stringValue(n)
+	case 0xca, 0xcb:
+		f, err := d.float(c)
+		if err != nil {
+			return nil, err
+		}
+		return structpb.NewNumberValue(f), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		b, err := d.bytes(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return d.enc.uint(d.field, readUint(b)), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		b, err := d.bytes(1 << (c - 0xd0))
+		if err != nil {
+			return nil, err
+		}
+		return d.enc.int(d.field, readInt(b)), nil
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.listValue(n)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapValue(n)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		// fixext: type and 1, 2, 4, 8 or 16 bytes
+		if _, err := d.bytes(1 + 1<<(c-0xd4)); err != nil {
+			return nil, err
+		}
+		d.invalid = true
+		return structpb.NewNullValue(), nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := d.bytes(1 + n); err != nil {
+			return nil, err
+		}
+		d.invalid = true
+		return structpb.NewNullValue(), nil
+	default:
+		return nil, fmt.Errorf("invalid msgpack type 0x%02x at %d", c, d.pos-1)
+	}
+}
+
+func (d *msgpackDecoder) stringValue(n int) (*structpb.Value, error) {
+	b, err := d.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	if !utf8.Valid(b) {
+		return structpb.NewStringValue(d.enc.bytes(b)), nil
+	}
+	return structpb.NewStringValue(string(b)), nil
+}
+
+// key returns false for map keys which aren't valid UTF-8 strings.
+func (d *msgpackDecoder) key() (string, bool, error) {
+	if d.pos >= len(d.data) {
+		return "", false, errMsgpackShort
+	}
+	var n int
+	c := d.data[d.pos]
+	if size, ok := stringLenSize(c); ok {
+		d.pos++
+		var err error
+		if n, err = d.uint(size); err != nil {
+			return "", false, err
+		}
+	} else if c&0xe0 == 0xa0 {
+		d.pos++
+		n = int(c & 0x1f)
+	} else {
+		invalid := d.invalid
+		_, err := d.value()
+		d.invalid = invalid
+		return "", false, err
+	}
+	b, err := d.bytes(n)
+	if err != nil {
+		return "", false, err
+	}
+	return string(b), utf8.Valid(b), nil
+}
+
+// stringLenSize returns size of length prefix of str and bin types.
+func stringLenSize(c byte) (int, bool) {
+	switch c {
+	case 0xd9, 0xc4:
+		return 1, true
+	case 0xda, 0xc5:
+		return 2, true
+	case 0xdb, 0xc6:
+		return 4, true
+	default:
+		return 0, false
+	}
+}
+
+func (d *msgpackDecoder) listValue(n int) (*structpb.Value, error) {
+	values := make([]*structpb.Value, n)
+	for i := range values {
+		value, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return structpb.NewListValue(&structpb.ListValue{Values: values}), nil
+}
+
+// mapValue drops fields with non-string keys and fields with values which structpb can't represent.
+func (d *msgpackDecoder) mapValue(n int) (*structpb.Value, error) {
+	// nested invalid value invalidates the whole top level field, as structpb.NewValue fails on it
+	nested := d.invalid
+	fields := make(map[string]*structpb.Value, n)
+	for i := 0; i < n; i++ {
+		key, keyValid, err := d.key()
+		if err != nil {
+			return nil, err
+		}
+
+		d.invalid = false
+		parent := d.field
+		d.field = key
+		value, err := d.value()
+		d.field = parent
+		if err != nil {
+			return nil, err
+		}
+		if !keyValid {
+			continue
+		}
+		if d.invalid {
+			nested = true
+			continue
+		}
+		fields[key] = value
+	}
+	d.invalid = nested
+	return structpb.NewStructValue(&structpb.Struct{Fields: fields}), nil
+}
+
+func (d *msgpackDecoder) float(c byte) (float64, error) {
+	if c == 0xca {
+		b, err := d.bytes(4)
+		if err != nil {
+			return 0, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	}
+	b, err := d.bytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+}
+
+func (d *msgpackDecoder) uint(size int) (int, error) {
+	b, err := d.bytes(size)
+	if err != nil {
+		return 0, err
+	}
+	n := readUint(b)
+	if n > uint64(len(d.data)) {
+		return 0, errMsgpackShort
+	}
+	return int(n), nil
+}
+
+func (d *msgpackDecoder) byte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errMsgpackShort
+	}
+	c := d.data[d.pos]
+	d.pos++
+	return c, nil
+}
+
+func (d *msgpackDecoder) bytes(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, errMsgpackShort
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func readUint(b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b))
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b))
+	default:
+		return binary.BigEndian.Uint64(b)
+	}
+}
+
+func readInt(b []byte) int64 {
+	switch len(b) {
+	case 1:
+		return int64(int8(b[0]))
+	case 2:
+		return int64(int16(binary.BigEndian.Uint16(b)))
+	case 4:
+		return int64(int32(binary.BigEndian.Uint32(b)))
+	default:
+		return int64(binary.BigEndian.Uint64(b))
+	}
+}
@@ -0,0 +1,323 @@
+package plugin
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/fluent/fluent-bit-go/output"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+// appendMsgpack encodes test values the same way Fluent Bit does.
+func appendMsgpack(b []byte, v interface{}) []byte {
+	switch typed := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if typed {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case int:
+		return appendMsgpack(b, int64(typed))
+	case int64:
+		if typed >= 0 {
+			return appendMsgpack(b, uint64(typed))
+		}
+		if typed >= -32 {
+			return append(b, byte(typed))
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(typed))
+	case uint64:
+		if typed <= 0x7f {
+			return append(b, byte(typed))
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), typed)
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(typed))
+	case string:
+		return append(binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(len(typed))), typed...)
+	case []byte:
+		return append(binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(len(typed))), typed...)
+	case output.FLBTime:
+		b = append(b, 0xd7, flbTimeExtType)
+		b = binary.BigEndian.AppendUint32(b, uint32(typed.Unix()))
+		return binary.BigEndian.AppendUint32(b, uint32(typed.Nanosecond()))
+	case []interface{}:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(len(typed)))
+		for _, el := range typed {
+			b = appendMsgpack(b, el)
+		}
+		return b
+	case map[string]interface{}:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(len(typed)))
+		for key, val := range typed {
+			b = appendMsgpack(appendMsgpack(b, key), val)
+		}
+		return b
+	default:
+		panic(fmt.Sprintf("unsupported type %T", v))
+	}
+}
+
+func sampleChunk(n int) []byte {
+	ts := output.FLBTime{Time: time.Unix(1688206830, 123456789)}
+	var chunk []byte
+	for i := 0; i < n; i++ {
+		record := map[string]interface{}{
+			"log":    fmt.Sprintf("GET /api/v1/items/%d HTTP/1.1 200", i),
+			"level":  "INFO",
+			"stream": "stdout",
+			"kubernetes": map[string]interface{}{
+				"namespace_name": "prod",
+				"pod_name":       fmt.Sprintf("api-%d", i%3),
+				"container_name": "api",
+				"labels": map[string]interface{}{
+					"app":               "api",
+					"pod-template-hash": "7d9c6b5f4",
+				},
+				"container_image": "cr.yandex/api:1.2.3",
+			},
+			"duration": 0.125,
+			"status":   200,
+			"bytes":    -1,
+			"tags":     []interface{}{"a", "b", nil, true},
+		}
+		header := interface{}(ts)
+		if i%2 == 1 {
+			header = []interface{}{ts, map[string]interface{}{"otel": map[string]interface{}{"trace_id": "abc"}}}
+		}
+		chunk = appendMsgpack(chunk, []interface{}{header, record})
+	}
+	return chunk
+}
+
+func samplePlugin() *Plugin {
+	return &Plugin{
+		keys: &parseKeys{
+			level:            "level",
+			message:          "log",
+			resourceType:     mustNewTemplate("k8s"),
+			resourceID:       mustNewTemplate("{kubernetes/namespace_name}"),
+			streamName:       mustNewTemplate("{kubernetes/pod_name}"),
+			eventMetadataKey: "meta",
+		},
+	}
+}
+
+// transformGetRecord is the reference path on top of output.GetRecord.
+func transformGetRecord(p *Plugin, chunk []byte) map[model.BatchKey][]*model.Entry {
+	dec := output.NewDecoder(unsafe.Pointer(&chunk[0]), len(chunk))
+	return p.transformRecords(func() (ret int, ts interface{}, rec map[interface{}]interface{}) {
+		return output.GetRecord(dec)
+	}, "tag")
+}
+
+func assertSameEntries(t *testing.T, expected, actual map[model.BatchKey][]*model.Entry) {
+	assert.Equal(t, len(expected), len(actual))
+	for key, entries := range expected {
+		assert.Equal(t, len(entries), len(actual[key]), "%+v", key)
+		for i := range entries {
+			if i >= len(actual[key]) {
+				break
+			}
+			e, a := entries[i], actual[key][i]
+			assert.Equal(t, e.Timestamp, a.Timestamp)
+			assert.Equal(t, e.Level, a.Level)
+			assert.Equal(t, e.Message, a.Message)
+			assert.Equal(t, e.StreamName, a.StreamName)
+			assert.True(t, proto.Equal(e.JSONPayload, a.JSONPayload), "%v != %v", e.JSONPayload, a.JSONPayload)
+		}
+	}
+}
+
+func TestTransformMsgpack_Success(t *testing.T) {
+	chunk := sampleChunk(6)
+	p := samplePlugin()
+
+	expected := transformGetRecord(p, chunk)
+	actual := p.TransformMsgpack(chunk, "tag")
+
+	assert.Equal(t, 3, len(actual))
+	assertSameEntries(t, expected, actual)
+
+	entries := actual[model.BatchKey{Resource: model.Resource{Type: "k8s", ID: "prod"}, StreamName: "api-1"}]
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, time.Unix(1688206830, 123456789), entries[0].Timestamp)
+	assert.Equal(t, "GET /api/v1/items/1 HTTP/1.1 200", entries[0].Message)
+	assert.Equal(t, "INFO", entries[0].Level)
+	assert.Equal(t, "abc", entries[0].JSONPayload.AsMap()["meta"].(map[string]interface{})["otel"].(map[string]interface{})["trace_id"])
+	assert.Equal(t, float64(-1), entries[0].JSONPayload.AsMap()["bytes"])
+}
+
+func TestTransformMsgpack_Unrepresentable_Success(t *testing.T) {
+	record := map[string]interface{}{
+		"valid":   []byte("bytes"),
+		"invalid": []byte{0xff, 0xfe},
+		"nested": map[string]interface{}{
+			"ok":      "value",
+			"invalid": []byte{0xff},
+		},
+		"list": []interface{}{"ok", []byte{0xff}},
+		"ext":  output.FLBTime{Time: time.Unix(1, 0)},
+		"deep": map[string]interface{}{"ext": []interface{}{output.FLBTime{Time: time.Unix(1, 0)}}},
+		"int":  math.MinInt64,
+	}
+	chunk := appendMsgpack(nil, []interface{}{uint64(1688206830), record})
+	chunk = appendMsgpack(chunk, []interface{}{1688206830.5, map[string]interface{}{"a": "b"}})
+	p := &Plugin{
+		keys: &parseKeys{
+			resourceType: mustNewTemplate("type"),
+			resourceID:   mustNewTemplate("id"),
+			streamName:   mustNewTemplate("stream"),
+		},
+	}
+
+	expected := transformGetRecord(p, chunk)
+	actual := p.TransformMsgpack(chunk, "tag")
+
+	assertSameEntries(t, expected, actual)
+	var payloads []map[string]interface{}
+	for _, entries := range actual {
+		for _, entry := range entries {
+			payloads = append(payloads, entry.JSONPayload.AsMap())
+		}
+	}
+	assert.Contains(t, payloads, map[string]interface{}{
+		"valid":   "bytes",
+		"invalid": "//4=",
+		"nested":  map[string]interface{}{"ok": "value", "invalid": "/w=="},
+		"list":    []interface{}{"ok", "/w=="},
+		"int":     float64(math.MinInt64),
+	})
+	assert.Contains(t, payloads, map[string]interface{}{"a": "b"})
+}
+
+func TestTransformMsgpack_Fail(t *testing.T) {
+	chunk := sampleChunk(2)
+	p := samplePlugin()
+
+	// broken tail doesn't affect records decoded before it
+	tails := [][]byte{nil, {0xc1}, {0x91, 0x01}}
+	for i, tail := range tails {
+		expected := 2
+		broken := append(append([]byte(nil), chunk...), tail...)
+		if i == 0 {
+			broken = broken[:len(broken)-1]
+			expected = 1
+		}
+		count := 0
+		for _, entries := range p.TransformMsgpack(broken, "tag") {
+			count += len(entries)
+		}
+		assert.Equal(t, expected, count)
+	}
+	assert.Empty(t, p.TransformMsgpack(appendMsgpack(nil, []interface{}{1, "record"}), "tag"))
+	assert.Empty(t, p.TransformMsgpack(nil, "tag"))
+}
+
+func TestTransformMsgpack_InvalidTimeExtension_Success(t *testing.T) {
+	record := appendMsgpack(nil, map[string]interface{}{
+		"log":        "message",
+		"kubernetes": map[string]interface{}{"namespace_name": "prod", "pod_name": "api-0"},
+	})
+	var chunk []byte
+	for _, ts := range [][]byte{
+		// unknown extension type
+		{0xd7, 0x05, 0, 0, 0, 1, 0, 0, 0, 0},
+		// EventTime of unexpected length
+		{0xc7, 0x04, flbTimeExtType, 0, 0, 0, 1},
+	} {
+		chunk = append(append(append(chunk, 0x92), ts...), record...)
+	}
+	chunk = append(chunk, sampleChunk(1)...)
+	p := samplePlugin()
+
+	start := time.Now()
+	entries := make([]*model.Entry, 0)
+	for _, e := range p.TransformMsgpack(chunk, "tag") {
+		entries = append(entries, e...)
+	}
+
+	// only time of events with invalid extension defaults to now
+	assert.Equal(t, 3, len(entries))
+	defaulted := 0
+	for _, e := range entries {
+		if !e.Timestamp.Before(start) {
+			defaulted++
+		} else {
+			assert.Equal(t, time.Unix(1688206830, 123456789), e.Timestamp)
+		}
+	}
+	assert.Equal(t, 2, defaulted)
+}
+
+// BenchmarkTransform compares allocations of output.GetRecord and direct msgpack decoding,
+// i.e. go test ./plugin -run=^$ -bench=Transform
+func BenchmarkTransform(b *testing.B) {
+	chunk := sampleChunk(100)
+	p := samplePlugin()
+
+	b.Run("get_record", func(b *testing.B) {
+		b.SetBytes(int64(len(chunk)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			transformGetRecord(p, chunk)
+		}
+	})
+	b.Run("msgpack", func(b *testing.B) {
+		b.SetBytes(int64(len(chunk)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p.TransformMsgpack(chunk, "tag")
+		}
+	})
+}
+
+// groupChunk wraps records into Fluent Bit event group with start and end markers.
+func groupChunk() []byte {
+	groupMeta := map[string]interface{}{"resource": map[string]interface{}{"service": "api"}}
+	chunk := appendMsgpack(nil, []interface{}{[]interface{}{int64(-1), groupMeta}, map[string]interface{}{}})
+	chunk = append(chunk, sampleChunk(2)...)
+	return appendMsgpack(chunk, []interface{}{[]interface{}{int64(-2), map[string]interface{}{}}, map[string]interface{}{}})
+}
+
+func TestTransform_GroupMarkers_Success(t *testing.T) {
+	p := samplePlugin()
+
+	expected := transformGetRecord(p, groupChunk())
+	count := 0
+	for _, entries := range expected {
+		for _, entry := range entries {
+			assert.Equal(t, time.Unix(1688206830, 123456789), entry.Timestamp)
+			count++
+		}
+	}
+	assert.Equal(t, 2, count)
+
+	assertSameEntries(t, expected, p.TransformMsgpack(groupChunk(), "tag"))
+}
+
+func TestMsgpackDecoder_Time_Success(t *testing.T) {
+	for data, expected := range map[string]interface{}{
+		"\x05":         int64(5),
+		"\xff":         int64(-1),
+		"\xfe":         int64(-2),
+		"\xe0":         int64(-32),
+		"\xd0\x80":     int64(-128),
+		"\xcd\x01\x00": uint64(256),
+		"\xd7\x00\x00\x00\x00\x01\x00\x00\x00\x02": output.FLBTime{Time: time.Unix(1, 2)},
+	} {
+		ts, err := newMsgpackDecoder([]byte(data), &valueEncoder{}).time()
+
+		assert.Nil(t, err, "%x", data)
+		assert.Equal(t, expected, ts, "%x", data)
+	}
+}
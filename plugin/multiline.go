@@ -0,0 +1,156 @@
+package plugin
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+// multiline joins messages of consecutive entries with the same destination, resource and stream,
+// i.e. lines of stack traces. Entry matching start pattern begins a new joined entry,
+// entries matching continuation pattern are appended to it. If only one pattern is set,
+// entries not matching it are treated as matching the other one.
+// Joined entry keeps timestamp, level and payload of its first line.
+type multiline struct {
+	startPattern    *regexp.Regexp
+	continuePattern *regexp.Regexp
+	// timeout limits time joined entry is held since its first line
+	timeout time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	pending map[model.BatchKey]*joinedEntry
+
+	stop chan struct{}
+	// done is closed when run is finished, nil if it wasn't started
+	done chan struct{}
+}
+
+type joinedEntry struct {
+	entry *model.Entry
+	lines []string
+	since time.Time
+}
+
+func newMultiline(startPattern, continuePattern *regexp.Regexp, timeout time.Duration) *multiline {
+	return &multiline{
+		startPattern:    startPattern,
+		continuePattern: continuePattern,
+		timeout:         timeout,
+		now:             time.Now,
+		pending:         make(map[model.BatchKey]*joinedEntry),
+		stop:            make(chan struct{}),
+	}
+}
+
+// join returns entries ready to be sent, the last joined entry of each key is held until the next start line or timeout.
+func (m *multiline) join(keyToEntries map[model.BatchKey][]*model.Entry) map[model.BatchKey][]*model.Entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ready := make(map[model.BatchKey][]*model.Entry)
+	for key, entries := range keyToEntries {
+		for _, e := range entries {
+			isStart, isContinue := m.match(e.Message)
+			pending := m.pending[key]
+			switch {
+			case isContinue && pending != nil:
+				pending.lines = append(pending.lines, e.Message)
+			case isStart:
+				if pending != nil {
+					ready[key] = append(ready[key], pending.merged())
+				}
+				m.pending[key] = &joinedEntry{entry: e, lines: []string{e.Message}, since: m.now()}
+			default:
+				if pending != nil {
+					ready[key] = append(ready[key], pending.merged())
+					delete(m.pending, key)
+				}
+				ready[key] = append(ready[key], e)
+			}
+		}
+	}
+	return ready
+}
+
+func (m *multiline) match(message string) (isStart, isContinue bool) {
+	if m.startPattern != nil {
+		isStart = m.startPattern.MatchString(message)
+	}
+	if m.continuePattern != nil {
+		isContinue = m.continuePattern.MatchString(message)
+	}
+	switch {
+	case m.startPattern == nil:
+		isStart = !isContinue
+	case m.continuePattern == nil:
+		isContinue = !isStart
+	}
+	return isStart, isContinue
+}
+
+// expired returns joined entries held longer than timeout.
+func (m *multiline) expired() map[model.BatchKey][]*model.Entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	ready := make(map[model.BatchKey][]*model.Entry)
+	for key, pending := range m.pending {
+		if now.Sub(pending.since) >= m.timeout {
+			ready[key] = []*model.Entry{pending.merged()}
+			delete(m.pending, key)
+		}
+	}
+	return ready
+}
+
+// run passes expired entries to flush until close.
+func (m *multiline) run(flush func(map[model.BatchKey][]*model.Entry)) {
+	m.done = make(chan struct{})
+	interval := m.timeout / 2
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				if expired := m.expired(); len(expired) > 0 {
+					flush(expired)
+				}
+			}
+		}
+	}()
+}
+
+// close stops flushing expired entries and returns all held ones.
+func (m *multiline) close() map[model.BatchKey][]*model.Entry {
+	close(m.stop)
+	if m.done != nil {
+		<-m.done
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ready := make(map[model.BatchKey][]*model.Entry)
+	for key, pending := range m.pending {
+		ready[key] = []*model.Entry{pending.merged()}
+	}
+	m.pending = make(map[model.BatchKey]*joinedEntry)
+	return ready
+}
+
+func (j *joinedEntry) merged() *model.Entry {
+	j.entry.Message = strings.Join(j.lines, "\n")
+	return j.entry
+}
@@ -0,0 +1,180 @@
+package plugin
+
+import (
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fluent/fluent-bit-go/output"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/test"
+)
+
+func messageEntries(messages ...string) []*model.Entry {
+	entries := make([]*model.Entry, len(messages))
+	for i, message := range messages {
+		entries[i] = &model.Entry{Message: message}
+	}
+	return entries
+}
+
+func messages(entries []*model.Entry) []string {
+	result := make([]string, len(entries))
+	for i, e := range entries {
+		result[i] = e.Message
+	}
+	return result
+}
+
+func TestMultiline_Start_Success(t *testing.T) {
+	m := newMultiline(regexp.MustCompile(`^\S`), nil, time.Second)
+	key := model.BatchKey{StreamName: "java"}
+	other := model.BatchKey{StreamName: "other"}
+
+	ready := m.join(map[model.BatchKey][]*model.Entry{
+		key: messageEntries(
+			"Started",
+			"java.lang.IllegalStateException: boom",
+			"\tat com.example.App.run(App.java:10)",
+			"\tat com.example.App.main(App.java:5)",
+		),
+		other: messageEntries("\tindented without start"),
+	})
+
+	assert.Equal(t, []string{"Started"}, messages(ready[key]))
+	assert.Equal(t, []string{"\tindented without start"}, messages(ready[other]))
+
+	// trace is continued in the next chunk
+	ready = m.join(map[model.BatchKey][]*model.Entry{
+		key: messageEntries("Caused by: java.io.IOException", "\t... 2 more", "Next"),
+	})
+
+	assert.Equal(t, []string{
+		"java.lang.IllegalStateException: boom\n" +
+			"\tat com.example.App.run(App.java:10)\n" +
+			"\tat com.example.App.main(App.java:5)",
+		"Caused by: java.io.IOException\n\t... 2 more",
+	}, messages(ready[key]))
+	assert.Equal(t, []string{"Next"}, messages(m.close()[key]))
+}
+
+func TestMultiline_StartAndContinue_Success(t *testing.T) {
+	m := newMultiline(
+		regexp.MustCompile(`^Traceback`),
+		regexp.MustCompile(`^(\s|\w+Error:)`),
+		time.Second,
+	)
+	key := model.BatchKey{}
+	entries := messageEntries(
+		"Traceback (most recent call last):",
+		`  File "app.py", line 1, in <module>`,
+		"ValueError: boom",
+		"plain line",
+		"  indented plain line",
+	)
+	entries[0].Level = "ERROR"
+
+	ready := m.join(map[model.BatchKey][]*model.Entry{key: entries})
+
+	assert.Equal(t, []string{
+		"Traceback (most recent call last):\n  File \"app.py\", line 1, in <module>\nValueError: boom",
+		"plain line",
+		"  indented plain line",
+	}, messages(ready[key]))
+	assert.Equal(t, "ERROR", ready[key][0].Level)
+	assert.Empty(t, m.close())
+}
+
+func TestMultiline_Expired_Success(t *testing.T) {
+	m := newMultiline(nil, regexp.MustCompile(`^\s`), time.Second)
+	now := time.Unix(1688206830, 0)
+	m.now = func() time.Time {
+		return now
+	}
+	key := model.BatchKey{}
+
+	ready := m.join(map[model.BatchKey][]*model.Entry{key: messageEntries("first", " second")})
+	assert.Empty(t, ready)
+	assert.Empty(t, m.expired())
+
+	now = now.Add(time.Second)
+	ready = m.join(map[model.BatchKey][]*model.Entry{key: messageEntries(" third")})
+	assert.Empty(t, ready)
+
+	assert.Equal(t, []string{"first\n second\n third"}, messages(m.expired()[key]))
+	assert.Empty(t, m.close())
+}
+
+func TestFlush_Multiline_Success(t *testing.T) {
+	configMap = map[string]string{
+		"multiline_start":         `^\S`,
+		"multiline_flush_timeout": "20ms",
+	}
+	client := &recordingClient{}
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, client)
+	assert.Nil(t, err)
+
+	code := plugin.Flush(map[model.BatchKey][]*model.Entry{{}: messageEntries("first", "second", " continued")})
+	assert.Equal(t, output.FLB_OK, code)
+	assert.Equal(t, 1, client.requestCount())
+
+	// held entry is sent after flush timeout
+	assert.Eventually(t, func() bool {
+		return client.requestCount() == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"second\n continued"}, messages(client.requests[1].Entries))
+
+	plugin.Flush(map[model.BatchKey][]*model.Entry{{}: messageEntries("last")})
+	plugin.Close()
+
+	assert.Equal(t, 3, client.requestCount())
+	assert.Equal(t, []string{"last"}, messages(client.requests[2].Entries))
+}
+
+func TestFlush_MultilineRetry_Success(t *testing.T) {
+	configMap = map[string]string{
+		"multiline_start":         `^\S`,
+		"multiline_flush_timeout": "20ms",
+	}
+	var calls int32
+	flaky := &recordingClient{
+		write: func(*model.WriteRequest) (map[int64]*status.Status, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return nil, grpcstatus.Error(codes.Unavailable, "unavailable")
+			}
+			return nil, nil
+		},
+	}
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, flaky)
+	assert.Nil(t, err)
+
+	assert.Equal(t, output.FLB_OK, plugin.Flush(map[model.BatchKey][]*model.Entry{{}: messageEntries("first", " continued")}))
+
+	// joined entry released after flush timeout is retried after failed write
+	assert.Eventually(t, func() bool {
+		return flaky.requestCount() == 2
+	}, 3*time.Second, 10*time.Millisecond)
+	plugin.Close()
+
+	assert.Equal(t, []string{"first\n continued"}, messages(flaky.requests[1].Entries))
+}
+
+func TestInit_Multiline_Fail(t *testing.T) {
+	for _, cfg := range []map[string]string{
+		{"multiline_start": "("},
+		{"multiline_continue": "["},
+		{"multiline_start": "^\\S", "multiline_flush_timeout": "0"},
+	} {
+		configMap = cfg
+
+		_, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,163 @@
+package plugin
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type payloadMode string
+
+const (
+	payloadAsIs      payloadMode = "as_is"
+	payloadFlatten   payloadMode = "flatten"
+	payloadUnflatten payloadMode = "unflatten"
+)
+
+// default separators of payload keys, i.e. kubernetes_labels_app and http.status
+const (
+	defaultFlattenSeparator   = "_"
+	defaultUnflattenSeparator = "."
+)
+
+// payloadShape rearranges payload fields according to payload_mode.
+// maxDepth limits number of key parts joined by flatten or split by unflatten, 0 means no limit.
+type payloadShape struct {
+	mode      payloadMode
+	separator string
+	maxDepth  int
+}
+
+// apply returns new fields, nested values of record are never modified.
+func (s payloadShape) apply(fields map[string]*structpb.Value) map[string]*structpb.Value {
+	switch s.mode {
+	case payloadFlatten:
+		return s.flatten(fields)
+	case payloadUnflatten:
+		return s.unflatten(fields)
+	default:
+		return fields
+	}
+}
+
+// flatten joins keys of nested objects with separator. Keys present in payload take precedence
+// over joined ones, joined keys conflicting with each other are resolved in key order.
+// Lists are kept as is.
+func (s payloadShape) flatten(fields map[string]*structpb.Value) map[string]*structpb.Value {
+	flat := make(map[string]*structpb.Value, len(fields))
+	for key, value := range fields {
+		if !s.flattenable(value, 1) {
+			flat[key] = value
+		}
+	}
+	for _, key := range sortedFieldKeys(fields) {
+		if value := fields[key]; s.flattenable(value, 1) {
+			s.flattenInto(flat, key, value.GetStructValue(), 2)
+		}
+	}
+	return flat
+}
+
+// flattenInto adds fields of nested object, keys of which have depth parts.
+func (s payloadShape) flattenInto(flat map[string]*structpb.Value, prefix string, nested *structpb.Struct, depth int) {
+	for _, key := range sortedFieldKeys(nested.GetFields()) {
+		value := nested.GetFields()[key]
+		name := prefix + s.separator + key
+		if s.flattenable(value, depth) {
+			s.flattenInto(flat, name, value.GetStructValue(), depth+1)
+			continue
+		}
+		if _, ok := flat[name]; !ok {
+			flat[name] = value
+		}
+	}
+}
+
+// flattenable returns true for non-empty object which key has depth parts.
+func (s payloadShape) flattenable(value *structpb.Value, depth int) bool {
+	if s.maxDepth > 0 && depth >= s.maxDepth {
+		return false
+	}
+	return len(value.GetStructValue().GetFields()) > 0
+}
+
+// unflatten splits top level keys by separator into nested objects, merging them with existing ones.
+// Keys conflicting with non-object values or with each other are kept as is, keys are processed in order.
+func (s payloadShape) unflatten(fields map[string]*structpb.Value) map[string]*structpb.Value {
+	nested := make(map[string]*structpb.Value, len(fields))
+	var split []string
+	for key, value := range fields {
+		if strings.Contains(key, s.separator) {
+			split = append(split, key)
+		} else {
+			nested[key] = value
+		}
+	}
+	sort.Strings(split)
+
+	// objects created by unflatten, other ones are copied before modification
+	created := make(map[*structpb.Struct]bool)
+	for _, key := range split {
+		n := -1
+		if s.maxDepth > 0 {
+			n = s.maxDepth
+		}
+		if !insertPath(nested, strings.SplitN(key, s.separator, n), fields[key], created) {
+			nested[key] = fields[key]
+		}
+	}
+	return nested
+}
+
+// insertPath returns false if value can't be placed by path.
+func insertPath(fields map[string]*structpb.Value, path []string, value *structpb.Value, created map[*structpb.Struct]bool) bool {
+	for _, name := range path {
+		if len(name) == 0 {
+			return false
+		}
+	}
+	last := len(path) - 1
+	for _, name := range path[:last] {
+		existing, ok := fields[name]
+		if !ok {
+			object := &structpb.Struct{Fields: make(map[string]*structpb.Value)}
+			created[object] = true
+			fields[name] = structpb.NewStructValue(object)
+			fields = object.Fields
+			continue
+		}
+		object := existing.GetStructValue()
+		if object == nil {
+			return false
+		}
+		if !created[object] {
+			object = &structpb.Struct{Fields: copyFields(object.GetFields())}
+			created[object] = true
+			fields[name] = structpb.NewStructValue(object)
+		}
+		fields = object.Fields
+	}
+	if _, ok := fields[path[last]]; ok {
+		return false
+	}
+	fields[path[last]] = value
+	return true
+}
+
+func copyFields(fields map[string]*structpb.Value) map[string]*structpb.Value {
+	copied := make(map[string]*structpb.Value, len(fields)+1)
+	for key, value := range fields {
+		copied[key] = value
+	}
+	return copied
+}
+
+func sortedFieldKeys(fields map[string]*structpb.Value) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
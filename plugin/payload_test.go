@@ -0,0 +1,125 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func shapePayload(shape payloadShape, payload map[string]interface{}) map[string]interface{} {
+	fields, _ := structpb.NewStruct(payload)
+	return (&structpb.Struct{Fields: shape.apply(fields.Fields)}).AsMap()
+}
+
+func TestPayloadShape_Flatten_Success(t *testing.T) {
+	payload := map[string]interface{}{
+		"kubernetes": map[string]interface{}{
+			"namespace_name": "prod",
+			"labels":         map[string]interface{}{"app": "api", "tier": "backend"},
+			"annotations":    map[string]interface{}{},
+		},
+		"tags":   []interface{}{map[string]interface{}{"a": "b"}},
+		"status": float64(200),
+		// explicit key takes precedence over joined one
+		"kubernetes_namespace_name": "explicit",
+	}
+	shape := payloadShape{mode: payloadFlatten, separator: "_"}
+
+	assert.Equal(t, map[string]interface{}{
+		"kubernetes_namespace_name": "explicit",
+		"kubernetes_labels_app":     "api",
+		"kubernetes_labels_tier":    "backend",
+		"kubernetes_annotations":    map[string]interface{}{},
+		"tags":                      []interface{}{map[string]interface{}{"a": "b"}},
+		"status":                    float64(200),
+	}, shapePayload(shape, payload))
+
+	shape.maxDepth = 2
+	shape.separator = "."
+	assert.Equal(t, map[string]interface{}{
+		"kubernetes.namespace_name": "prod",
+		"kubernetes.labels":         map[string]interface{}{"app": "api", "tier": "backend"},
+		"kubernetes.annotations":    map[string]interface{}{},
+		"tags":                      []interface{}{map[string]interface{}{"a": "b"}},
+		"status":                    float64(200),
+		"kubernetes_namespace_name": "explicit",
+	}, shapePayload(shape, payload))
+
+	shape.maxDepth = 1
+	assert.Equal(t, payload, shapePayload(shape, payload))
+}
+
+func TestPayloadShape_Unflatten_Success(t *testing.T) {
+	payload := map[string]interface{}{
+		"http.status":    float64(200),
+		"http.method":    "GET",
+		"http.url.path":  "/api",
+		"user":           "root",
+		"user.id":        float64(1),
+		"kubernetes":     map[string]interface{}{"pod": "api-0"},
+		"kubernetes.ns":  "prod",
+		"trailing.":      "kept",
+		"plain":          true,
+		"double..dot":    "kept",
+		"kubernetes.pod": "conflict",
+	}
+	shape := payloadShape{mode: payloadUnflatten, separator: "."}
+
+	assert.Equal(t, map[string]interface{}{
+		"http": map[string]interface{}{
+			"status": float64(200),
+			"method": "GET",
+			"url":    map[string]interface{}{"path": "/api"},
+		},
+		"user":           "root",
+		"user.id":        float64(1),
+		"kubernetes":     map[string]interface{}{"pod": "api-0", "ns": "prod"},
+		"kubernetes.pod": "conflict",
+		"trailing.":      "kept",
+		"plain":          true,
+		"double..dot":    "kept",
+	}, shapePayload(shape, payload))
+
+	shape.maxDepth = 2
+	assert.Equal(t, map[string]interface{}{"http": map[string]interface{}{"url.path": "/api"}},
+		shapePayload(shape, map[string]interface{}{"http.url.path": "/api"}))
+}
+
+func TestPayloadShape_Record_NotModified_Success(t *testing.T) {
+	pk := &parseKeys{
+		message:      "log",
+		resourceType: mustNewTemplate(""),
+		resourceID:   mustNewTemplate(""),
+		streamName:   mustNewTemplate(""),
+		payloadShape: payloadShape{mode: payloadUnflatten, separator: "."},
+	}
+	record := toStruct(map[interface{}]interface{}{
+		"log":             "message",
+		"kubernetes":      map[interface{}]interface{}{"pod": "api-0"},
+		"kubernetes.ns":   "prod",
+		"kubernetes.deep": map[interface{}]interface{}{"a": "b"},
+	})
+	original := record.AsMap()
+
+	entry, _, err := pk.entry(time.Now(), record, nil, "tag", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "message", entry.Message)
+	assert.Equal(t, map[string]interface{}{
+		"kubernetes": map[string]interface{}{"pod": "api-0", "ns": "prod", "deep": map[string]interface{}{"a": "b"}},
+	}, entry.JSONPayload.AsMap())
+	assert.Equal(t, original, record.AsMap())
+
+	pk.payloadShape = payloadShape{mode: payloadFlatten, separator: "_"}
+	entry, _, err = pk.entry(time.Now(), record, nil, "tag", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"kubernetes_pod":    "api-0",
+		"kubernetes.ns":     "prod",
+		"kubernetes.deep_a": "b",
+	}, entry.JSONPayload.AsMap())
+	assert.Equal(t, original, record.AsMap())
+}
@@ -1,22 +1,47 @@
 package plugin
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"google.golang.org/protobuf/types/known/structpb"
+
 	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/client"
 	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/config"
 	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/metadata"
 	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
 )
 
-type nextRecordProvider func() (ret int, ts interface{}, rec map[interface{}]interface{})
-
 type Plugin struct {
 	getConfigValue   func(string) string
 	metadataProvider metadata.Provider
 
-	keys *parseKeys
+	keys   *parseKeys
+	routes []*route
+
+	encoder valueEncoder
+	// binaryFields counts record values with non UTF-8 bytes encoded since start
+	binaryFields atomic.Uint64
+
+	writeOpts    writeOptions
+	messageLimit messageLimit
+	limiter      *rateLimiter
+	aimd         *aimdController
+	async        *asyncQueue
+	multiline    *multiline
+
+	shutdownOpts shutdownOptions
+	// ctx is canceled on exit to interrupt writes
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	closeMu  sync.RWMutex
+	closing  bool
+	inFlight sync.WaitGroup
 
 	client client.Client
 }
@@ -27,10 +52,78 @@ func New(getConfigValue func(string) string, metadataProvider metadata.Provider,
 		metadataProvider: metadataProvider,
 	}
 
-	keys := getParseKeys(getConfigValue, metadataProvider)
+	keys, err := getParseKeys(getConfigValue, metadataProvider)
+	if err != nil {
+		return nil, err
+	}
 	p.keys = keys
 
+	routes, err := getRoutes(getConfigValue, metadataProvider, keys)
+	if err != nil {
+		return nil, err
+	}
+	p.routes = routes
+
+	encoder, err := getValueEncoder(getConfigValue)
+	if err != nil {
+		return nil, err
+	}
+	p.encoder = encoder
+
+	writeOpts, err := getWriteOptions(getConfigValue)
+	if err != nil {
+		return nil, err
+	}
+	p.writeOpts = writeOpts
+
+	messageLimit, err := getMessageLimit(getConfigValue)
+	if err != nil {
+		return nil, err
+	}
+	p.messageLimit = messageLimit
+
+	limiter, err := getRateLimiter(getConfigValue)
+	if err != nil {
+		return nil, err
+	}
+	p.limiter = limiter
+
+	aimd, err := getAIMDController(getConfigValue)
+	if err != nil {
+		return nil, err
+	}
+	p.aimd = aimd
+
+	async, err := getAsyncQueue(getConfigValue)
+	if err != nil {
+		return nil, err
+	}
+	p.async = async
+
+	multiline, err := getMultiline(getConfigValue)
+	if err != nil {
+		return nil, err
+	}
+	p.multiline = multiline
+
+	shutdownOpts, err := getShutdownOptions(getConfigValue, metadataProvider)
+	if err != nil {
+		return nil, err
+	}
+	p.shutdownOpts = shutdownOpts
+
 	p.client = ingestionClient
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
+	if p.async != nil {
+		p.async.start(p.send, p.unsent)
+	}
+	if p.multiline != nil {
+		p.multiline.run(p.flushJoined)
+	}
+	if p.shutdownOpts.spool != nil {
+		p.replaySpool()
+	}
 
 	return p, nil
 }
@@ -45,32 +138,61 @@ func (p *Plugin) InitClient() error {
 	return p.client.Init(authorization, endpoint, CAFileName)
 }
 
-func (p *Plugin) Transform(provider nextRecordProvider, tag string) map[model.Resource][]*model.Entry {
-	resourceToEntries := make(map[model.Resource][]*model.Entry)
+// TransformMsgpack decodes Fluent Bit chunk directly into entries, data is not referenced after return.
+func (p *Plugin) TransformMsgpack(data []byte, tag string) map[model.BatchKey][]*model.Entry {
+	enc := p.newEncoder()
+	decoder := newMsgpackDecoder(data, enc)
+	return p.transform(decoder.next, enc, tag)
+}
 
+// newEncoder returns copy of configured encoder for a single chunk.
+func (p *Plugin) newEncoder() *valueEncoder {
+	enc := p.encoder
+	return &enc
+}
+
+// transform reads events with next, enc is the encoder used by next.
+func (p *Plugin) transform(next func() (event, error), enc *valueEncoder, tag string) map[model.BatchKey][]*model.Entry {
+	keyToEntries := make(map[model.BatchKey][]*model.Entry)
+
+	warnings := newChunkWarnings()
 	for {
-		ret, ts, record := provider()
-		if ret != 0 {
+		ev, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Printf("yc-logging: failed to decode records: %s\n", err.Error())
 			break
 		}
 
-		entry, res, err := p.entry(toTime(ts), record, tag)
+		ts, err := toTime(ev.time)
 		if err != nil {
-			fmt.Printf("yc-logging: could not write entry %v because of error: %s\n", record, err.Error())
-			continue
+			warnings.printf(warningEventTime, "yc-logging: %s: defaulting to now\n", err.Error())
+			ts = time.Now()
 		}
-		entries, ok := resourceToEntries[res]
-		if ok {
-			entries = append(entries, entry)
-		} else {
-			entries = []*model.Entry{entry}
+
+		entry, key, err := p.entry(ts, ev.record, ev.meta, tag, warnings)
+		if err != nil {
+			fmt.Printf("yc-logging: could not write entry %v because of error: %s\n", ev.record.AsMap(), err.Error())
+			continue
 		}
-		resourceToEntries[res] = entries
+		keyToEntries[key] = append(keyToEntries[key], entry)
+	}
+
+	if enc.binaryCount > 0 {
+		total := p.binaryFields.Add(uint64(enc.binaryCount))
+		fmt.Printf("yc-logging: %d values with non UTF-8 bytes encoded as %s, %d since start\n", enc.binaryCount, enc.binary, total)
 	}
 
-	return resourceToEntries
+	return keyToEntries
 }
 
-func (p *Plugin) entry(ts time.Time, record map[interface{}]interface{}, tag string) (*model.Entry, model.Resource, error) {
-	return p.keys.entry(ts, record, tag)
+func (p *Plugin) entry(ts time.Time, record, meta *structpb.Struct, tag string, warnings *chunkWarnings) (*model.Entry, model.BatchKey, error) {
+	for _, r := range p.routes {
+		if r.match(record, meta, tag) {
+			return r.keys.entry(ts, record, meta, tag, warnings)
+		}
+	}
+	return p.keys.entry(ts, record, meta, tag, warnings)
 }
@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/yandex-cloud/go-genproto/yandex/cloud/logging/v1"
@@ -39,9 +40,9 @@ func TestInit_AllConfig_Success(t *testing.T) {
 	assert.Equal(t, "level", plugin.keys.level)
 	assert.Equal(t, "message", plugin.keys.message)
 	assert.Equal(t, "message_tag", plugin.keys.messageTag)
-	assert.Equal(t, &template{"resource_type", [][]string{}}, plugin.keys.resourceType)
-	assert.Equal(t, &template{"resource_id", [][]string{}}, plugin.keys.resourceID)
-	assert.Equal(t, &template{"stream_name", [][]string{}}, plugin.keys.streamName)
+	assert.Equal(t, &template{[]templateToken{{literal: "resource_type"}}}, plugin.keys.resourceType)
+	assert.Equal(t, &template{[]templateToken{{literal: "resource_id"}}}, plugin.keys.resourceID)
+	assert.Equal(t, &template{[]templateToken{{literal: "stream_name"}}}, plugin.keys.streamName)
 }
 
 func TestInit_AllConfigTemplated_Success(t *testing.T) {
@@ -67,8 +68,8 @@ func TestInit_AllConfigTemplated_Success(t *testing.T) {
 	assert.Equal(t, "metadata_level", plugin.keys.level)
 	assert.Equal(t, "metadata_message", plugin.keys.message)
 	assert.Equal(t, "message_metadata_tag", plugin.keys.messageTag)
-	assert.Equal(t, &template{"resource_metadata_type", [][]string{}}, plugin.keys.resourceType)
-	assert.Equal(t, &template{"resource_metadata_id", [][]string{}}, plugin.keys.resourceID)
+	assert.Equal(t, &template{[]templateToken{{literal: "resource_metadata_type"}}}, plugin.keys.resourceType)
+	assert.Equal(t, &template{[]templateToken{{literal: "resource_metadata_id"}}}, plugin.keys.resourceID)
 }
 
 func TestTransform_Success(t *testing.T) {
@@ -86,22 +87,22 @@ func TestTransform_Success(t *testing.T) {
 	}
 	plugin := Plugin{
 		keys: &parseKeys{
-			resourceType: newTemplate("{type}"),
-			resourceID:   newTemplate("{id}"),
-			streamName:   newTemplate("{stream}"),
+			resourceType: mustNewTemplate("{type}"),
+			resourceID:   mustNewTemplate("{id}"),
+			streamName:   mustNewTemplate("{stream}"),
 		},
 	}
 
-	resourceToEntries := plugin.Transform(recordProvider, "tag")
+	keyToEntries := plugin.transformRecords(recordProvider, "tag")
 
-	assert.NotNil(t, resourceToEntries)
-	actual1 := resourceToEntries[model.Resource{Type: "1_type", ID: "1_id"}]
+	assert.NotNil(t, keyToEntries)
+	actual1 := keyToEntries[model.BatchKey{Resource: model.Resource{Type: "1_type", ID: "1_id"}, StreamName: "stream1"}]
 	assert.Equal(t, 1, len(actual1))
 	actualPayload1 := actual1[0].JSONPayload.AsMap()
 	assert.Equal(t, float64(10), actualPayload1["name"])
 	assert.Equal(t, "1_type", actualPayload1["type"])
 	assert.Equal(t, "1_id", actualPayload1["id"])
-	actual2 := resourceToEntries[model.Resource{Type: "2_type", ID: "2_id"}]
+	actual2 := keyToEntries[model.BatchKey{Resource: model.Resource{Type: "2_type", ID: "2_id"}, StreamName: "stream1"}]
 	assert.Equal(t, 1, len(actual2))
 	actualPayload2 := actual2[0].JSONPayload.AsMap()
 	assert.Equal(t, float64(20), actualPayload2["name"])
@@ -132,25 +133,385 @@ func TestTransform_IdentifyingResource_Success(t *testing.T) {
 	}
 	plugin := Plugin{
 		keys: &parseKeys{
-			resourceType: newTemplate("{type}"),
-			resourceID:   newTemplate("{id}"),
-			streamName:   newTemplate("{stream}"),
+			resourceType: mustNewTemplate("{type}"),
+			resourceID:   mustNewTemplate("{id}"),
+			streamName:   mustNewTemplate("{stream}"),
 		},
 	}
 
-	resourceToEntries := plugin.Transform(recordProvider, "tag")
+	keyToEntries := plugin.transformRecords(recordProvider, "tag")
 
-	expected := map[model.Resource][]*logging.IncomingLogEntry{
-		{Type: "1_type", ID: "1_id"}: {{StreamName: "stream1"}},
-		{Type: "1_type", ID: "2_id"}: {{StreamName: "stream1"}, {StreamName: "stream1"}},
-		{Type: "2_type", ID: "1_id"}: {{StreamName: "stream1"}, {StreamName: "stream1"}, {StreamName: "stream1"}},
-		{Type: "2_type", ID: "2_id"}: {{StreamName: "stream1"}, {StreamName: "stream1"}, {StreamName: "stream1"}, {StreamName: "stream1"}},
+	expected := map[model.BatchKey][]*logging.IncomingLogEntry{
+		{Resource: model.Resource{Type: "1_type", ID: "1_id"}, StreamName: "stream1"}: {{StreamName: "stream1"}},
+		{Resource: model.Resource{Type: "1_type", ID: "2_id"}, StreamName: "stream1"}: {{StreamName: "stream1"}, {StreamName: "stream1"}},
+		{Resource: model.Resource{Type: "2_type", ID: "1_id"}, StreamName: "stream1"}: {{StreamName: "stream1"}, {StreamName: "stream1"}, {StreamName: "stream1"}},
+		{Resource: model.Resource{Type: "2_type", ID: "2_id"}, StreamName: "stream1"}: {{StreamName: "stream1"}, {StreamName: "stream1"}, {StreamName: "stream1"}, {StreamName: "stream1"}},
 	}
-	assert.NotNil(t, resourceToEntries)
-	assert.Equal(t, len(expected), len(resourceToEntries))
+	assert.NotNil(t, keyToEntries)
+	assert.Equal(t, len(expected), len(keyToEntries))
 	for k, v := range expected {
-		actualV, ok := resourceToEntries[k]
+		actualV, ok := keyToEntries[k]
 		assert.True(t, ok)
 		assert.Equal(t, len(v), len(actualV))
 	}
 }
+
+func TestInit_InvalidTimeFormat_Fail(t *testing.T) {
+	configMap = map[string]string{
+		"time_key":    "time",
+		"time_format": "%Y-%Q",
+	}
+	metadataProvider := test.MetadataProvider{}
+	client := &test.Client{}
+
+	_, err := New(getConfigValue, metadataProvider, client)
+
+	assert.NotNil(t, err)
+}
+
+func TestInit_InvalidTemplateErrorPolicy_Fail(t *testing.T) {
+	configMap = map[string]string{
+		"on_template_error": "ignore",
+	}
+	metadataProvider := test.MetadataProvider{}
+	client := &test.Client{}
+
+	_, err := New(getConfigValue, metadataProvider, client)
+
+	assert.NotNil(t, err)
+}
+
+func TestTransform_IdentifyingDestination_Success(t *testing.T) {
+	records := []map[interface{}]interface{}{
+		{"namespace": "ns1", "id": "1_id"},
+		{"namespace": "ns1", "id": "1_id"},
+		{"namespace": "ns2", "id": "1_id"},
+	}
+	var cur uint64
+	recordProvider := func() (ret int, ts interface{}, rec map[interface{}]interface{}) {
+		if int(cur) >= len(records) {
+			return 1, nil, nil
+		}
+		cur++
+		return 0, cur - 1, records[cur-1]
+	}
+	plugin := Plugin{
+		keys: &parseKeys{
+			resourceType: mustNewTemplate(""),
+			resourceID:   mustNewTemplate("{id}"),
+			streamName:   mustNewTemplate(""),
+			groupID:      mustNewTemplate("group_{namespace}"),
+		},
+	}
+
+	keyToEntries := plugin.transformRecords(recordProvider, "tag")
+
+	assert.Equal(t, 2, len(keyToEntries))
+	assert.Equal(t, 2, len(keyToEntries[model.BatchKey{
+		Destination: model.Destination{LogGroupID: "group_ns1"},
+		Resource:    model.Resource{ID: "1_id"},
+	}]))
+	assert.Equal(t, 1, len(keyToEntries[model.BatchKey{
+		Destination: model.Destination{LogGroupID: "group_ns2"},
+		Resource:    model.Resource{ID: "1_id"},
+	}]))
+}
+
+func TestTransform_IdentifyingStream_Success(t *testing.T) {
+	records := []map[interface{}]interface{}{
+		{"id": "1_id", "stream": "stream1"},
+		{"id": "1_id", "stream": "stream2"},
+		{"id": "1_id", "stream": "stream1"},
+	}
+	var cur uint64
+	recordProvider := func() (ret int, ts interface{}, rec map[interface{}]interface{}) {
+		if int(cur) >= len(records) {
+			return 1, nil, nil
+		}
+		cur++
+		return 0, cur - 1, records[cur-1]
+	}
+	plugin := Plugin{
+		keys: &parseKeys{
+			resourceType: mustNewTemplate(""),
+			resourceID:   mustNewTemplate("{id}"),
+			streamName:   mustNewTemplate("{stream}"),
+		},
+	}
+
+	keyToEntries := plugin.transformRecords(recordProvider, "tag")
+
+	assert.Equal(t, 2, len(keyToEntries))
+	assert.Equal(t, 2, len(keyToEntries[model.BatchKey{Resource: model.Resource{ID: "1_id"}, StreamName: "stream1"}]))
+	assert.Equal(t, 1, len(keyToEntries[model.BatchKey{Resource: model.Resource{ID: "1_id"}, StreamName: "stream2"}]))
+}
+
+func TestInit_RateLimit_Success(t *testing.T) {
+	configMap = map[string]string{
+		"rate_limit_entries": "1000",
+		"rate_limit_bytes":   "1048576",
+		"rate_limit_mode":    "retry",
+	}
+	metadataProvider := test.MetadataProvider{}
+	client := &test.Client{}
+
+	plugin, err := New(getConfigValue, metadataProvider, client)
+
+	assert.Nil(t, err)
+	assert.NotNil(t, plugin.limiter)
+	assert.Equal(t, float64(1000), plugin.limiter.entriesPerSecond)
+	assert.Equal(t, float64(1048576), plugin.limiter.bytesPerSecond)
+	assert.False(t, plugin.limiter.wait)
+}
+
+func TestInit_RateLimit_Fail(t *testing.T) {
+	for _, cfg := range []map[string]string{
+		{"rate_limit_entries": "-1"},
+		{"rate_limit_bytes": "1M"},
+		{"rate_limit_entries": "10", "rate_limit_mode": "drop"},
+	} {
+		configMap = cfg
+
+		_, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+		assert.NotNil(t, err)
+	}
+}
+
+func TestInit_AdaptiveConcurrency_Success(t *testing.T) {
+	configMap = map[string]string{
+		"adaptive_concurrency": "on",
+		"max_concurrency":      "4",
+	}
+
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+	assert.Nil(t, err)
+	assert.NotNil(t, plugin.aimd)
+	assert.Equal(t, 4, plugin.aimd.maxLimit)
+}
+
+func TestInit_AdaptiveConcurrency_Fail(t *testing.T) {
+	configMap = map[string]string{
+		"adaptive_concurrency": "on",
+		"max_concurrency":      "0",
+	}
+
+	_, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+	assert.NotNil(t, err)
+}
+
+func TestInit_Async_Success(t *testing.T) {
+	configMap = map[string]string{
+		"async":            "true",
+		"async_queue_size": "4",
+		"async_senders":    "2",
+	}
+
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+	assert.Nil(t, err)
+	assert.NotNil(t, plugin.async)
+	assert.Equal(t, 4, cap(plugin.async.chunks))
+	assert.Equal(t, 2, plugin.async.senders)
+	plugin.Close()
+}
+
+func TestInit_Async_Fail(t *testing.T) {
+	for _, cfg := range []map[string]string{
+		{"async": "maybe"},
+		{"async": "true", "async_queue_size": "0"},
+		{"async": "true", "async_senders": "x"},
+	} {
+		configMap = cfg
+
+		_, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+		assert.NotNil(t, err)
+	}
+}
+
+func TestInit_Shutdown_Success(t *testing.T) {
+	for value, expected := range map[string]time.Duration{
+		"":      5 * time.Second,
+		"10":    10 * time.Second,
+		"1m30s": 90 * time.Second,
+	} {
+		configMap = map[string]string{
+			"shutdown_timeout": value,
+		}
+
+		plugin, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, plugin.shutdownOpts.timeout)
+		assert.Nil(t, plugin.shutdownOpts.spool)
+	}
+}
+
+func TestInit_Shutdown_Fail(t *testing.T) {
+	for _, value := range []string{"-1", "soon", "-5s"} {
+		configMap = map[string]string{
+			"shutdown_timeout": value,
+		}
+
+		_, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+		assert.NotNil(t, err)
+	}
+}
+
+func TestInit_MaxMessageBytes_Success(t *testing.T) {
+	configMap = map[string]string{
+		"max_message_bytes":  "65536",
+		"max_message_policy": "split",
+	}
+
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, messageLimit{maxBytes: 65536, policy: messageLimitSplit}, plugin.messageLimit)
+}
+
+func TestInit_MaxMessageBytes_Fail(t *testing.T) {
+	for _, cfg := range []map[string]string{
+		{"max_message_bytes": "-1"},
+		{"max_message_bytes": "3"},
+		{"max_message_bytes": "1k"},
+		{"max_message_bytes": "100", "max_message_policy": "drop"},
+	} {
+		configMap = cfg
+
+		_, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+		assert.NotNil(t, err)
+	}
+}
+
+func TestInit_BinaryEncoding_Success(t *testing.T) {
+	configMap = map[string]string{
+		"binary_encoding": "lossy-replace",
+	}
+
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, binaryLossyReplace, plugin.encoder.binary)
+}
+
+func TestInit_BinaryEncoding_Fail(t *testing.T) {
+	configMap = map[string]string{
+		"binary_encoding": "utf16",
+	}
+
+	_, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+	assert.NotNil(t, err)
+}
+
+func TestInit_IntAsString_Success(t *testing.T) {
+	configMap = map[string]string{
+		"large_int_as_string": "true",
+		"int_as_string_keys":  "trace_id  span_id",
+	}
+
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+	assert.Nil(t, err)
+	assert.True(t, plugin.encoder.largeInts)
+	assert.Equal(t, map[string]bool{"trace_id": true, "span_id": true}, plugin.encoder.intKeys)
+}
+
+func TestInit_IntAsString_Fail(t *testing.T) {
+	configMap = map[string]string{
+		"large_int_as_string": "maybe",
+	}
+
+	_, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+	assert.NotNil(t, err)
+}
+
+func TestInit_PayloadMode_Success(t *testing.T) {
+	configMap = map[string]string{
+		"payload_mode":      "unflatten",
+		"payload_max_depth": "3",
+	}
+
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, payloadShape{mode: payloadUnflatten, separator: ".", maxDepth: 3}, plugin.keys.payloadShape)
+
+	configMap = map[string]string{
+		"payload_mode":      "flatten",
+		"payload_separator": "/",
+	}
+
+	plugin, err = New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, payloadShape{mode: payloadFlatten, separator: "/"}, plugin.keys.payloadShape)
+
+	configMap = map[string]string{
+		"payload_mode":      "flatten",
+		"payload_max_depth": "0",
+	}
+
+	plugin, err = New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, payloadShape{mode: payloadFlatten, separator: "_"}, plugin.keys.payloadShape)
+}
+
+func TestInit_PayloadMode_Fail(t *testing.T) {
+	for _, cfg := range []map[string]string{
+		{"payload_mode": "nested"},
+		{"payload_mode": "flatten", "payload_max_depth": "-1"},
+		{"payload_mode": "flatten", "payload_max_depth": "deep"},
+	} {
+		configMap = cfg
+
+		_, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+		assert.NotNil(t, err)
+	}
+}
+
+func TestInit_PayloadKey_Success(t *testing.T) {
+	configMap = map[string]string{
+		"payload_key": "fields",
+	}
+
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "fields", plugin.keys.payloadKey)
+}
+
+func TestInit_ParseMessageJSON_Success(t *testing.T) {
+	configMap = map[string]string{
+		"message_key":        "log",
+		"level_key":          "level",
+		"parse_message_json": "true",
+		"json_message_key":   "msg",
+	}
+
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+	assert.Nil(t, err)
+	assert.True(t, plugin.keys.parseMessageJSON)
+	assert.Equal(t, "msg", plugin.keys.jsonMessage)
+	assert.Equal(t, "level", plugin.keys.jsonLevel)
+}
+
+func TestInit_ParseMessageJSON_Fail(t *testing.T) {
+	configMap = map[string]string{
+		"parse_message_json": "sure",
+	}
+
+	_, err := New(getConfigValue, test.MetadataProvider{}, &test.Client{})
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,177 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+// tokenBucket allows rate tokens per second with burst equal to one second of rate.
+// Requests larger than burst are allowed to make balance negative, so they are not starved.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		tokens: rate,
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+func (b *tokenBucket) refill() {
+	now := b.now()
+	b.tokens = math.Min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// reserve takes n tokens and returns time to wait until they are available.
+func (b *tokenBucket) reserve(n float64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// take takes n tokens only if they are available right now.
+func (b *tokenBucket) take(n float64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if b.tokens < math.Min(n, b.rate) {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+func (b *tokenBucket) refund(n float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = math.Min(b.rate, b.tokens+n)
+}
+
+// rateLimiter limits entries and bytes per second for each destination.
+type rateLimiter struct {
+	entriesPerSecond float64
+	bytesPerSecond   float64
+	// wait for budget if true, fail with ResourceExhausted otherwise
+	wait bool
+
+	mu      sync.Mutex
+	buckets map[model.Destination][]*rateBucket
+}
+
+type rateBucket struct {
+	bucket *tokenBucket
+	cost   func(entries []*model.Entry) float64
+}
+
+func newRateLimiter(entriesPerSecond, bytesPerSecond float64, wait bool) *rateLimiter {
+	return &rateLimiter{
+		entriesPerSecond: entriesPerSecond,
+		bytesPerSecond:   bytesPerSecond,
+		wait:             wait,
+		buckets:          make(map[model.Destination][]*rateBucket),
+	}
+}
+
+func (rl *rateLimiter) destinationBuckets(destination model.Destination) []*rateBucket {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	buckets, ok := rl.buckets[destination]
+	if ok {
+		return buckets
+	}
+	if rl.entriesPerSecond > 0 {
+		buckets = append(buckets, &rateBucket{
+			bucket: newTokenBucket(rl.entriesPerSecond),
+			cost: func(entries []*model.Entry) float64 {
+				return float64(len(entries))
+			},
+		})
+	}
+	if rl.bytesPerSecond > 0 {
+		buckets = append(buckets, &rateBucket{
+			bucket: newTokenBucket(rl.bytesPerSecond),
+			cost:   entriesSize,
+		})
+	}
+	rl.buckets[destination] = buckets
+	return buckets
+}
+
+// acquire waits until entries fit into destination budget, or fails with ResourceExhausted if limiter doesn't wait.
+func (rl *rateLimiter) acquire(ctx context.Context, destination model.Destination, entries []*model.Entry) error {
+	buckets := rl.destinationBuckets(destination)
+
+	if !rl.wait {
+		for i, b := range buckets {
+			if b.bucket.take(b.cost(entries)) {
+				continue
+			}
+			for _, taken := range buckets[:i] {
+				taken.bucket.refund(taken.cost(entries))
+			}
+			return status.Error(codes.ResourceExhausted, fmt.Sprintf("client-side rate limit exceeded for destination %+v", destination))
+		}
+		return nil
+	}
+
+	var delay time.Duration
+	for _, b := range buckets {
+		if d := b.bucket.reserve(b.cost(entries)); d > delay {
+			delay = d
+		}
+	}
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// entries are not written, so reserved budget is returned
+		for _, b := range buckets {
+			b.bucket.refund(b.cost(entries))
+		}
+		return ctx.Err()
+	}
+}
+
+// entriesSize estimates size of entries in WriteRequest.
+func entriesSize(entries []*model.Entry) float64 {
+	const timestampSize = 12
+	size := 0
+	for _, e := range entries {
+		size += len(e.Level) + len(e.StreamName) + len(e.Message) + timestampSize
+		if e.JSONPayload != nil {
+			size += proto.Size(e.JSONPayload)
+		}
+	}
+	return float64(size)
+}
@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+func newTestBucket(rate float64) (*tokenBucket, *time.Time) {
+	now := time.Unix(0, 0)
+	b := newTokenBucket(rate)
+	b.last = now
+	b.now = func() time.Time {
+		return now
+	}
+	return b, &now
+}
+
+func TestTokenBucket_Reserve_Success(t *testing.T) {
+	b, now := newTestBucket(10)
+
+	assert.Equal(t, time.Duration(0), b.reserve(10))
+	assert.Equal(t, 500*time.Millisecond, b.reserve(5))
+
+	*now = now.Add(time.Second)
+	assert.Equal(t, time.Duration(0), b.reserve(5))
+}
+
+func TestTokenBucket_Take_Success(t *testing.T) {
+	b, now := newTestBucket(10)
+
+	assert.True(t, b.take(8))
+	assert.False(t, b.take(8))
+
+	*now = now.Add(time.Second)
+	// requests larger than burst are allowed with full bucket
+	assert.True(t, b.take(100))
+	assert.False(t, b.take(1))
+
+	b.refund(100)
+	assert.True(t, b.take(10))
+}
+
+func TestRateLimiter_Retry_Fail(t *testing.T) {
+	rl := newRateLimiter(10, 0, false)
+	destination := model.Destination{LogGroupID: "group"}
+
+	assert.Nil(t, rl.acquire(context.Background(), destination, makeEntries(10)))
+	err := rl.acquire(context.Background(), destination, makeEntries(1))
+
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	// other destinations have their own budget
+	assert.Nil(t, rl.acquire(context.Background(), model.Destination{}, makeEntries(10)))
+}
+
+func TestRateLimiter_RetryRefund_Success(t *testing.T) {
+	rl := newRateLimiter(100, 10, false)
+	entries := makeEntries(1)
+
+	assert.Nil(t, rl.acquire(context.Background(), model.Destination{}, entries))
+	assert.NotNil(t, rl.acquire(context.Background(), model.Destination{}, entries))
+
+	buckets := rl.destinationBuckets(model.Destination{})
+	assert.InDelta(t, 99, buckets[0].bucket.tokens, 0.1)
+}
+
+func TestRateLimiter_Wait_Success(t *testing.T) {
+	rl := newRateLimiter(1000, 0, true)
+
+	start := time.Now()
+	assert.Nil(t, rl.acquire(context.Background(), model.Destination{}, makeEntries(1000)))
+	assert.Nil(t, rl.acquire(context.Background(), model.Destination{}, makeEntries(50)))
+
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+}
+
+func TestRateLimiter_WaitCanceled_Fail(t *testing.T) {
+	rl := newRateLimiter(1, 0, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Nil(t, rl.acquire(ctx, model.Destination{}, makeEntries(1)))
+	err := rl.acquire(ctx, model.Destination{}, makeEntries(1))
+
+	assert.Equal(t, context.Canceled, err)
+	buckets := rl.destinationBuckets(model.Destination{})
+	assert.InDelta(t, 0, buckets[0].bucket.tokens, 0.1)
+}
+
+func TestEntriesSize_Success(t *testing.T) {
+	entries := []*model.Entry{
+		{Level: "INFO", StreamName: "stream", Message: "message"},
+	}
+
+	assert.Equal(t, float64(4+6+7+12), entriesSize(entries))
+}
@@ -0,0 +1,132 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/logging/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gopkg.in/yaml.v3"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/metadata"
+)
+
+// route overrides parse keys for records matching Fluent Bit tag pattern and/or record value regexp.
+type route struct {
+	tag   string
+	key   *templateKey
+	regex *regexp.Regexp
+
+	keys *parseKeys
+}
+
+type routesConfig struct {
+	Routes []routeConfig `yaml:"routes"`
+}
+
+type routeConfig struct {
+	Match struct {
+		Tag   string `yaml:"tag"`
+		Key   string `yaml:"key"`
+		Regex string `yaml:"regex"`
+	} `yaml:"match"`
+	GroupID      string `yaml:"group_id"`
+	ResourceType string `yaml:"resource_type"`
+	ResourceID   string `yaml:"resource_id"`
+	StreamName   string `yaml:"stream_name"`
+	DefaultLevel string `yaml:"default_level"`
+}
+
+func (r *route) match(record, meta *structpb.Struct, tag string) bool {
+	if len(r.tag) > 0 && !matchTag(r.tag, tag) {
+		return false
+	}
+	if r.key != nil {
+		value, err := r.key.parse(record, meta)
+		if err != nil {
+			return false
+		}
+		return r.regex.MatchString(value)
+	}
+	return true
+}
+
+// loadRoutes reads ordered list of routes from YAML file, each of them is compiled into copy of base parse keys.
+func loadRoutes(fileName string, base *parseKeys, metadataProvider metadata.Provider) ([]*route, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routes file %s: %s", fileName, err.Error())
+	}
+
+	var config routesConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse routes file %s: %s", fileName, err.Error())
+	}
+
+	routes := make([]*route, 0, len(config.Routes))
+	for i, rc := range config.Routes {
+		r, err := newRoute(rc, base, metadataProvider)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route #%d in %s: %s", i+1, fileName, err.Error())
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+func newRoute(rc routeConfig, base *parseKeys, metadataProvider metadata.Provider) (*route, error) {
+	r := &route{tag: rc.Match.Tag}
+
+	if (len(rc.Match.Key) > 0) != (len(rc.Match.Regex) > 0) {
+		return nil, fmt.Errorf("match key and regex should be set together")
+	}
+	if len(rc.Match.Key) > 0 {
+		r.key = &templateKey{path: strings.Split(rc.Match.Key, "/")}
+		regex, err := regexp.Compile(rc.Match.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match regex: %s", err.Error())
+		}
+		r.regex = regex
+	}
+
+	keys := *base
+	overrides := []struct {
+		name  string
+		value string
+		to    **template
+	}{
+		{"group_id", rc.GroupID, &keys.groupID},
+		{"resource_type", rc.ResourceType, &keys.resourceType},
+		{"resource_id", rc.ResourceID, &keys.resourceID},
+		{"stream_name", rc.StreamName, &keys.streamName},
+	}
+	for _, o := range overrides {
+		if len(o.value) == 0 {
+			continue
+		}
+		t, err := newTemplate(metadata.Parse(o.value, metadataProvider))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", o.name, err.Error())
+		}
+		*o.to = t
+	}
+	if len(rc.GroupID) > 0 {
+		keys.tagRoutes = nil
+	}
+
+	if len(rc.DefaultLevel) > 0 {
+		level := metadata.Parse(rc.DefaultLevel, metadataProvider)
+		if _, ok := logging.LogLevel_Level_value[strings.ToUpper(level)]; !ok {
+			return nil, fmt.Errorf("invalid default_level %q", level)
+		}
+		keys.defaultLevel = level
+	}
+
+	r.keys = &keys
+	return r, nil
+}
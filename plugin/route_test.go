@@ -0,0 +1,130 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/test"
+)
+
+func writeRoutesFile(t *testing.T, content string) string {
+	fileName := filepath.Join(t.TempDir(), "routes.yaml")
+	err := os.WriteFile(fileName, []byte(content), 0o600)
+	assert.Nil(t, err)
+	return fileName
+}
+
+func TestLoadRoutes_Success(t *testing.T) {
+	fileName := writeRoutesFile(t, `
+routes:
+  - match:
+      tag: kube.*
+      key: kubernetes/namespace_name
+      regex: ^prod-
+    group_id: prod_group
+    resource_type: k8s
+    resource_id: "{kubernetes/pod_name}"
+    default_level: WARN
+  - match:
+      tag: app.*
+    stream_name: "{{stream}}"
+`)
+	base := &parseKeys{
+		resourceType: mustNewTemplate("base_type"),
+		resourceID:   mustNewTemplate("base_id"),
+		streamName:   mustNewTemplate("base_stream"),
+	}
+
+	routes, err := loadRoutes(fileName, base, test.MetadataProvider{"stream": "app_stream"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(routes))
+	assert.Equal(t, "kube.*", routes[0].tag)
+	assert.Equal(t, "WARN", routes[0].keys.defaultLevel)
+	assert.Equal(t, base.streamName, routes[0].keys.streamName)
+	assert.Equal(t, mustNewTemplate("app_stream"), routes[1].keys.streamName)
+	assert.Equal(t, base.resourceType, routes[1].keys.resourceType)
+	assert.Nil(t, routes[1].key)
+}
+
+func TestLoadRoutes_Fail(t *testing.T) {
+	for _, content := range []string{
+		"routes: [",
+		"routes:\n  - unknown: field\n",
+		"routes:\n  - match:\n      key: a\n",
+		"routes:\n  - match:\n      key: a\n      regex: \"[\"\n",
+		"routes:\n  - resource_id: \"{a|unknown}\"\n",
+		"routes:\n  - default_level: LOUD\n",
+	} {
+		fileName := writeRoutesFile(t, content)
+
+		_, err := loadRoutes(fileName, &parseKeys{}, test.MetadataProvider{})
+
+		assert.NotNil(t, err, content)
+	}
+}
+
+func TestLoadRoutes_NoFile_Fail(t *testing.T) {
+	_, err := loadRoutes(filepath.Join(t.TempDir(), "missing.yaml"), &parseKeys{}, test.MetadataProvider{})
+
+	assert.NotNil(t, err)
+}
+
+func TestRouteMatch_Success(t *testing.T) {
+	r, err := newRoute(routeConfig{}, &parseKeys{}, test.MetadataProvider{})
+	assert.Nil(t, err)
+	assert.True(t, r.match(toStruct(map[interface{}]interface{}{}), nil, "any"))
+
+	rc := routeConfig{}
+	rc.Match.Tag = "kube.*"
+	rc.Match.Key = "ns"
+	rc.Match.Regex = "^prod-"
+	r, err = newRoute(rc, &parseKeys{}, test.MetadataProvider{})
+	assert.Nil(t, err)
+	assert.True(t, r.match(toStruct(map[interface{}]interface{}{"ns": "prod-1"}), nil, "kube.log"))
+	assert.False(t, r.match(toStruct(map[interface{}]interface{}{"ns": "prod-1"}), nil, "app.log"))
+	assert.False(t, r.match(toStruct(map[interface{}]interface{}{"ns": "dev-1"}), nil, "kube.log"))
+	assert.False(t, r.match(toStruct(map[interface{}]interface{}{}), nil, "kube.log"))
+}
+
+func TestEntry_Routes_Success(t *testing.T) {
+	fileName := writeRoutesFile(t, `
+routes:
+  - match:
+      key: ns
+      regex: ^prod-
+    group_id: prod_group
+    stream_name: "{ns}"
+    default_level: WARN
+`)
+	base := &parseKeys{
+		level:        "level",
+		resourceType: mustNewTemplate(""),
+		resourceID:   mustNewTemplate(""),
+		streamName:   mustNewTemplate("base_stream"),
+	}
+	routes, err := loadRoutes(fileName, base, test.MetadataProvider{})
+	assert.Nil(t, err)
+	plugin := Plugin{keys: base, routes: routes}
+
+	entry, key, err := plugin.entry(time.Now(), toStruct(map[interface{}]interface{}{"ns": "prod-1"}), nil, "tag", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, model.Destination{LogGroupID: "prod_group"}, key.Destination)
+	assert.Equal(t, "prod-1", entry.StreamName)
+	assert.Equal(t, "WARN", entry.Level)
+
+	entry, _, err = plugin.entry(time.Now(), toStruct(map[interface{}]interface{}{"ns": "prod-2", "level": "ERROR"}), nil, "tag", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "ERROR", entry.Level)
+
+	entry, key, err = plugin.entry(time.Now(), toStruct(map[interface{}]interface{}{"ns": "dev-1"}), nil, "tag", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, model.Destination{}, key.Destination)
+	assert.Equal(t, "base_stream", entry.StreamName)
+	assert.Equal(t, "", entry.Level)
+}
@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fluent/fluent-bit-go/output"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+const clientCloseTimeout = time.Second
+
+// Close stops accepting entries and waits up to shutdown timeout for in-flight writes
+// and entries queued in async mode, then interrupts writes, spools unsent entries and closes client.
+func (p *Plugin) Close() {
+	p.closeMu.Lock()
+	if p.closing {
+		p.closeMu.Unlock()
+		return
+	}
+	p.closing = true
+	p.closeMu.Unlock()
+
+	timer := time.AfterFunc(p.shutdownOpts.timeout, func() {
+		fmt.Printf("yc-logging: shutdown timeout %s exceeded, interrupting writes\n", p.shutdownOpts.timeout)
+		p.cancelWrites()
+	})
+	defer timer.Stop()
+
+	if p.multiline != nil {
+		if held := p.multiline.close(); len(held) > 0 {
+			p.flushJoined(held)
+		}
+	}
+	if p.async != nil {
+		p.async.close(p.writeContext())
+	}
+	p.inFlight.Wait()
+	p.cancelWrites()
+
+	if p.client == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), clientCloseTimeout)
+	defer cancel()
+	if err := p.client.Close(ctx); err != nil {
+		fmt.Printf("yc-logging: failed to close client: %s\n", err.Error())
+	}
+}
+
+func (p *Plugin) writeContext() context.Context {
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+func (p *Plugin) cancelWrites() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+}
+
+func (p *Plugin) isClosing() bool {
+	p.closeMu.RLock()
+	defer p.closeMu.RUnlock()
+
+	return p.closing
+}
+
+// unsent spools entries which weren't sent before exit, if spool is configured.
+func (p *Plugin) unsent(keyToEntries map[model.BatchKey][]*model.Entry) {
+	count := countEntries(keyToEntries)
+	if p.shutdownOpts.spool == nil {
+		fmt.Printf("yc-logging: dropping %d entries on exit\n", count)
+		return
+	}
+	name, err := p.shutdownOpts.spool.save(keyToEntries)
+	if err != nil {
+		fmt.Printf("yc-logging: dropping %d entries on exit, failed to spool them: %s\n", count, err.Error())
+		return
+	}
+	fmt.Printf("yc-logging: spooled %d entries to %s\n", count, name)
+}
+
+// replaySpool sends chunks spooled on previous exit in background.
+func (p *Plugin) replaySpool() {
+	s := p.shutdownOpts.spool
+	names, err := s.files()
+	if err != nil {
+		fmt.Printf("yc-logging: failed to list spool directory %s: %s\n", s.dir, err.Error())
+		return
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	p.inFlight.Add(1)
+	go func() {
+		defer p.inFlight.Done()
+		for _, name := range names {
+			// chunks which aren't replayed before exit are kept in spool, so they aren't passed to unsent
+			if p.isClosing() {
+				return
+			}
+			keyToEntries, err := s.load(name)
+			if err != nil {
+				fmt.Printf("yc-logging: %s\n", err.Error())
+				continue
+			}
+			switch p.send(keyToEntries) {
+			case output.FLB_OK:
+			case output.FLB_RETRY:
+				fmt.Printf("yc-logging: failed to send spooled chunk %s, it will be retried on next start\n", name)
+				return
+			default:
+				// chunk is kept for inspection, but isn't replayed anymore
+				failed := name + spoolFailedSuffix
+				if err := os.Rename(name, failed); err != nil {
+					fmt.Printf("yc-logging: failed to rename spooled chunk %s: %s\n", name, err.Error())
+					return
+				}
+				fmt.Printf("yc-logging: failed to send spooled chunk, it is kept as %s\n", failed)
+				continue
+			}
+			if err := os.Remove(name); err != nil {
+				fmt.Printf("yc-logging: failed to remove spooled chunk %s: %s\n", name, err.Error())
+				return
+			}
+			fmt.Printf("yc-logging: sent %d spooled entries from %s\n", countEntries(keyToEntries), name)
+		}
+	}()
+}
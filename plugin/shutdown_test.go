@@ -0,0 +1,204 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fluent/fluent-bit-go/output"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/test"
+)
+
+func TestClose_WaitsForWrites_Success(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	client := &recordingClient{
+		write: func(*model.WriteRequest) (map[int64]*status.Status, error) {
+			started <- struct{}{}
+			<-release
+			return nil, nil
+		},
+	}
+	plugin := &Plugin{client: client, shutdownOpts: shutdownOptions{timeout: time.Minute}}
+	keyToEntries := map[model.BatchKey][]*model.Entry{{}: makeEntries(1)}
+
+	flushed := make(chan int)
+	go func() {
+		flushed <- plugin.Flush(keyToEntries)
+	}()
+	<-started
+	closed := make(chan struct{})
+	go func() {
+		plugin.Close()
+		close(closed)
+	}()
+
+	assert.Eventually(t, plugin.isClosing, time.Second, time.Millisecond)
+	assert.Equal(t, output.FLB_RETRY, plugin.Flush(keyToEntries))
+	select {
+	case <-closed:
+		t.Fatal("closed before write finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	assert.Equal(t, output.FLB_OK, <-flushed)
+	<-closed
+	assert.True(t, client.closed)
+}
+
+func TestClose_Timeout_Spool_Success(t *testing.T) {
+	dir := t.TempDir()
+	configMap = map[string]string{
+		"resource_type":    "type",
+		"resource_id":      "id",
+		"stream_name":      "stream",
+		"async":            "on",
+		"shutdown_timeout": "20ms",
+		"spool_dir":        dir,
+	}
+	unavailable := &recordingClient{
+		write: func(*model.WriteRequest) (map[int64]*status.Status, error) {
+			return nil, grpcstatus.Error(codes.Unavailable, "unavailable")
+		},
+	}
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, unavailable)
+	assert.Nil(t, err)
+
+	keyToEntries := map[model.BatchKey][]*model.Entry{{Resource: model.Resource{ID: "1"}}: makeEntries(3)}
+	assert.Equal(t, output.FLB_OK, plugin.Flush(keyToEntries))
+	plugin.Close()
+
+	names, err := plugin.shutdownOpts.spool.files()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(names))
+	assert.True(t, unavailable.closed)
+
+	// spooled chunk is sent on the next start
+	client := &recordingClient{}
+	plugin, err = New(getConfigValue, test.MetadataProvider{}, client)
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		return client.requestCount() == 1
+	}, time.Second, time.Millisecond)
+	plugin.Close()
+
+	assert.Equal(t, model.Resource{ID: "1"}, *client.requests[0].Resource)
+	assert.Equal(t, 3, len(client.requests[0].Entries))
+	names, err = plugin.shutdownOpts.spool.files()
+	assert.Nil(t, err)
+	assert.Empty(t, names)
+}
+
+func TestClose_MultilineSpool_Success(t *testing.T) {
+	dir := t.TempDir()
+	configMap = map[string]string{
+		"multiline_start":  `^\S`,
+		"shutdown_timeout": "20ms",
+		"spool_dir":        dir,
+	}
+	unavailable := &recordingClient{
+		write: func(*model.WriteRequest) (map[int64]*status.Status, error) {
+			return nil, grpcstatus.Error(codes.Unavailable, "unavailable")
+		},
+	}
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, unavailable)
+	assert.Nil(t, err)
+
+	// joined entry is held by multiline until exit
+	assert.Equal(t, output.FLB_OK, plugin.Flush(map[model.BatchKey][]*model.Entry{{}: messageEntries("first", " continued")}))
+	plugin.Close()
+
+	names, err := plugin.shutdownOpts.spool.files()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(names))
+	spooled, err := plugin.shutdownOpts.spool.load(names[0])
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"first\n continued"}, messages(spooled[model.BatchKey{}]))
+}
+
+func TestReplaySpool_Interrupted_Success(t *testing.T) {
+	dir := t.TempDir()
+	configMap = map[string]string{
+		"shutdown_timeout": "20ms",
+		"spool_dir":        dir,
+	}
+	s, err := newSpool(dir)
+	assert.Nil(t, err)
+	name, err := s.save(map[model.BatchKey][]*model.Entry{{}: makeEntries(1)})
+	assert.Nil(t, err)
+
+	unavailable := &recordingClient{
+		write: func(*model.WriteRequest) (map[int64]*status.Status, error) {
+			return nil, grpcstatus.Error(codes.Unavailable, "unavailable")
+		},
+	}
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, unavailable)
+	assert.Nil(t, err)
+	plugin.Close()
+
+	// chunk stays in spool as is
+	names, err := s.files()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{name}, names)
+}
+
+func TestReplaySpool_Rejected_Success(t *testing.T) {
+	dir := t.TempDir()
+	configMap = map[string]string{
+		"resource_type": "type",
+		"resource_id":   "id",
+		"stream_name":   "stream",
+		"spool_dir":     dir,
+	}
+	s, err := newSpool(dir)
+	assert.Nil(t, err)
+	name, err := s.save(map[model.BatchKey][]*model.Entry{{}: makeEntries(1)})
+	assert.Nil(t, err)
+
+	client := &recordingClient{
+		write: func(*model.WriteRequest) (map[int64]*status.Status, error) {
+			return nil, grpcstatus.Error(codes.InvalidArgument, "invalid")
+		},
+	}
+	plugin, err := New(getConfigValue, test.MetadataProvider{}, client)
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(name + spoolFailedSuffix)
+		return err == nil
+	}, time.Second, time.Millisecond)
+	plugin.Close()
+
+	names, err := s.files()
+	assert.Nil(t, err)
+	assert.Empty(t, names)
+}
+
+func TestClose_InterruptsWrites_Success(t *testing.T) {
+	client := &recordingClient{}
+	plugin := &Plugin{client: client, shutdownOpts: shutdownOptions{timeout: 10 * time.Millisecond}}
+	plugin.ctx, plugin.cancel = context.WithCancel(context.Background())
+	// the second batch waits for rate limit budget for a second
+	plugin.limiter = newRateLimiter(100, 0, true)
+
+	flushed := make(chan int)
+	go func() {
+		flushed <- plugin.Flush(map[model.BatchKey][]*model.Entry{{}: makeEntries(200)})
+	}()
+	assert.Eventually(t, func() bool {
+		return client.requestCount() == 1
+	}, time.Second, time.Millisecond)
+	start := time.Now()
+	plugin.Close()
+
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, output.FLB_RETRY, <-flushed)
+	assert.Equal(t, 1, client.requestCount())
+}
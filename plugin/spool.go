@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+// spool keeps entries which weren't sent before exit in directory, one JSON lines file per chunk.
+// Spooled chunks are sent again on the next start.
+type spool struct {
+	dir string
+
+	mu  sync.Mutex
+	seq int
+}
+
+const (
+	spoolFilePattern = "chunk-*.jsonl"
+	// spoolFailedSuffix is appended to chunks rejected on replay, so they don't match spoolFilePattern
+	spoolFailedSuffix = ".failed"
+)
+
+type spooledBatch struct {
+	LogGroupID   string          `json:"log_group_id,omitempty"`
+	FolderID     string          `json:"folder_id,omitempty"`
+	ResourceType string          `json:"resource_type,omitempty"`
+	ResourceID   string          `json:"resource_id,omitempty"`
+	StreamName   string          `json:"stream_name,omitempty"`
+	Entries      []*spooledEntry `json:"entries"`
+}
+
+type spooledEntry struct {
+	Timestamp   time.Time        `json:"timestamp"`
+	Level       string           `json:"level,omitempty"`
+	StreamName  string           `json:"stream_name,omitempty"`
+	Message     string           `json:"message,omitempty"`
+	JSONPayload *structpb.Struct `json:"json_payload,omitempty"`
+}
+
+func newSpool(dir string) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory %s: %s", dir, err.Error())
+	}
+	return &spool{dir: dir}, nil
+}
+
+// save writes chunk into a new file, which appears in directory only when it's complete.
+func (s *spool) save(keyToEntries map[model.BatchKey][]*model.Entry) (string, error) {
+	s.mu.Lock()
+	s.seq++
+	name := filepath.Join(s.dir, fmt.Sprintf("chunk-%d-%d.jsonl", time.Now().UnixNano(), s.seq))
+	s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, ".chunk-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(w)
+	for _, key := range sortedBatchKeys(keyToEntries) {
+		b := &spooledBatch{
+			LogGroupID:   key.Destination.LogGroupID,
+			FolderID:     key.Destination.FolderID,
+			ResourceType: key.Resource.Type,
+			ResourceID:   key.Resource.ID,
+			StreamName:   key.StreamName,
+		}
+		for _, e := range keyToEntries[key] {
+			b.Entries = append(b.Entries, &spooledEntry{
+				Timestamp:   e.Timestamp,
+				Level:       e.Level,
+				StreamName:  e.StreamName,
+				Message:     e.Message,
+				JSONPayload: e.JSONPayload,
+			})
+		}
+		if err := encoder.Encode(b); err != nil {
+			_ = tmp.Close()
+			return "", err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return name, os.Rename(tmp.Name(), name)
+}
+
+// files returns spooled chunks in order they were saved.
+func (s *spool) files() ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(s.dir, spoolFilePattern))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *spool) load(name string) (map[model.BatchKey][]*model.Entry, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keyToEntries := make(map[model.BatchKey][]*model.Entry)
+	decoder := json.NewDecoder(file)
+	for decoder.More() {
+		var b spooledBatch
+		if err := decoder.Decode(&b); err != nil {
+			return nil, fmt.Errorf("failed to parse spooled chunk %s: %s", name, err.Error())
+		}
+		key := model.BatchKey{
+			Destination: model.Destination{LogGroupID: b.LogGroupID, FolderID: b.FolderID},
+			Resource:    model.Resource{Type: b.ResourceType, ID: b.ResourceID},
+			StreamName:  b.StreamName,
+		}
+		for _, e := range b.Entries {
+			keyToEntries[key] = append(keyToEntries[key], &model.Entry{
+				Timestamp:   e.Timestamp,
+				Level:       e.Level,
+				StreamName:  e.StreamName,
+				Message:     e.Message,
+				JSONPayload: e.JSONPayload,
+			})
+		}
+	}
+	return keyToEntries, nil
+}
@@ -0,0 +1,64 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+func TestSpool_Success(t *testing.T) {
+	s, err := newSpool(filepath.Join(t.TempDir(), "spool"))
+	assert.Nil(t, err)
+	payload, _ := structpb.NewStruct(map[string]interface{}{"a": "b", "n": 1.5, "list": []interface{}{true, nil}})
+	keyToEntries := map[model.BatchKey][]*model.Entry{
+		{Resource: model.Resource{Type: "t", ID: "1"}, StreamName: "s"}: {
+			{Timestamp: time.Unix(1688206830, 123456789).UTC(), Level: "INFO", StreamName: "s", Message: "first", JSONPayload: payload},
+			{Timestamp: time.Unix(1688206831, 0).UTC(), Message: "second"},
+		},
+		{Destination: model.Destination{LogGroupID: "group"}}: {
+			{Timestamp: time.Unix(1688206832, 0).UTC(), Message: "third"},
+		},
+	}
+
+	first, err := s.save(keyToEntries)
+	assert.Nil(t, err)
+	second, err := s.save(map[model.BatchKey][]*model.Entry{{}: {{Message: "later"}}})
+	assert.Nil(t, err)
+
+	names, err := s.files()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{first, second}, names)
+
+	loaded, err := s.load(first)
+	assert.Nil(t, err)
+	assert.Equal(t, len(keyToEntries), len(loaded))
+	for key, entries := range keyToEntries {
+		assert.Equal(t, len(entries), len(loaded[key]))
+		for i, e := range entries {
+			actual := loaded[key][i]
+			assert.True(t, e.Timestamp.Equal(actual.Timestamp))
+			assert.Equal(t, e.Level, actual.Level)
+			assert.Equal(t, e.StreamName, actual.StreamName)
+			assert.Equal(t, e.Message, actual.Message)
+			assert.True(t, proto.Equal(e.JSONPayload, actual.JSONPayload))
+		}
+	}
+}
+
+func TestSpool_Load_Fail(t *testing.T) {
+	s, err := newSpool(t.TempDir())
+	assert.Nil(t, err)
+	name := filepath.Join(s.dir, "chunk-1-1.jsonl")
+	assert.Nil(t, os.WriteFile(name, []byte(`{"entries": [`), 0o644))
+
+	_, err = s.load(name)
+
+	assert.NotNil(t, err)
+}
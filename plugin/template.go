@@ -2,50 +2,178 @@ package plugin
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
+// template is compiled into tokens, each of them is either literal or record key.
 type template struct {
-	format string
-	keys   [][]string
+	tokens []templateToken
+}
+
+type templateToken struct {
+	literal string
+	key     *templateKey
+}
+
+type templateKey struct {
+	path    []string
+	filters []templateFilter
 }
 
-var templateReg = regexp.MustCompile(`{[^{}]+}`)
+// templateMetaPrefix is the first path element of template keys
+// which refer to Fluent Bit event metadata instead of record, i.e. {$meta/otel/trace_id}.
+const templateMetaPrefix = "$meta"
 
 func (t *template) isTemplated() bool {
-	return len(t.keys) != 0
+	for _, token := range t.tokens {
+		if token.key != nil {
+			return true
+		}
+	}
+	return false
 }
 
-func (t *template) parse(record map[interface{}]interface{}) (string, error) {
-	if !t.isTemplated() {
-		return t.format, nil
+// ParseGroupID renders group_id without record keys, templated group_id is resolved for each entry.
+func ParseGroupID(raw string) (groupID string, templated bool, err error) {
+	t, err := newTemplate(raw)
+	if err != nil {
+		return "", false, err
 	}
+	if t.isTemplated() {
+		return "", true, nil
+	}
+	return t.parseStatic(nil, nil), false, nil
+}
 
-	values := make([]interface{}, 0)
-	for _, path := range t.keys {
-		value, err := getRecordValue(record, path)
-		if err != nil {
+func (t *template) parse(record, meta *structpb.Struct) (string, error) {
+	return t.render(record, meta, true)
+}
+
+// parseStatic never fails, replacing values missing in record with empty strings.
+func (t *template) parseStatic(record, meta *structpb.Struct) string {
+	value, _ := t.render(record, meta, false)
+	return value
+}
+
+func (t *template) render(record, meta *structpb.Struct, strict bool) (string, error) {
+	if len(t.tokens) == 1 && t.tokens[0].key == nil {
+		return t.tokens[0].literal, nil
+	}
+
+	var result strings.Builder
+	for _, token := range t.tokens {
+		if token.key == nil {
+			result.WriteString(token.literal)
+			continue
+		}
+		value, err := token.key.parse(record, meta)
+		if err != nil && strict {
 			return "", err
 		}
-		values = append(values, value)
+		result.WriteString(value)
 	}
 
-	return fmt.Sprintf(t.format, values...), nil
+	return result.String(), nil
 }
 
-func newTemplate(raw string) *template {
-	format := templateReg.ReplaceAllString(raw, "%s")
-	paths := templateReg.FindAllString(raw, -1)
+func (k *templateKey) parse(record, meta *structpb.Struct) (string, error) {
+	from, path := record, k.path
+	if len(path) > 0 && path[0] == templateMetaPrefix {
+		from, path = meta, path[1:]
+	}
+	value, err := getRecordValue(from, path)
+	found := err == nil
+	for _, filter := range k.filters {
+		value, found = filter(value, found)
+	}
+	if !found {
+		return "", err
+	}
+	return value, nil
+}
 
-	keys := make([][]string, len(paths))
-	for i, p := range paths {
-		p = p[1 : len(p)-1]
-		keys[i] = strings.Split(p, "/")
+// newTemplate compiles raw value with record keys like {path/to/key:default|func:arg|func}.
+// Literal braces and backslashes are escaped with backslash: \{, \}, \\.
+// Unmatched and empty braces are kept literally for compatibility, with a warning.
+func newTemplate(raw string) (*template, error) {
+	tokens := make([]templateToken, 0)
+	var literal strings.Builder
+	flushLiteral := func() {
+		if literal.Len() > 0 {
+			tokens = append(tokens, templateToken{literal: literal.String()})
+			literal.Reset()
+		}
 	}
 
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case c == '\\' && i+1 < len(raw) && strings.IndexByte(`{}\`, raw[i+1]) >= 0:
+			literal.WriteByte(raw[i+1])
+			i++
+		case c == '{':
+			end, body, err := scanTemplateKey(raw, i+1)
+			if err != nil {
+				fmt.Printf("yc-logging: template %q: %s, keeping it literally\n", raw, err.Error())
+				literal.WriteByte(c)
+				continue
+			}
+			key, err := newTemplateKey(body)
+			if err != nil {
+				return nil, fmt.Errorf("invalid template %q: %s", raw, err.Error())
+			}
+			flushLiteral()
+			tokens = append(tokens, templateToken{key: key})
+			i = end
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	flushLiteral()
+
 	return &template{
-		format: format,
-		keys:   keys,
+		tokens: tokens,
+	}, nil
+}
+
+// scanTemplateKey returns position of closing brace and key body, unescaping \{ and \}.
+// Error means that brace at start-1 doesn't open a key.
+func scanTemplateKey(raw string, start int) (int, string, error) {
+	var body strings.Builder
+	for i := start; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case c == '\\' && i+1 < len(raw) && (raw[i+1] == '{' || raw[i+1] == '}'):
+			body.WriteByte(raw[i+1])
+			i++
+		case c == '{':
+			return 0, "", fmt.Errorf("unmatched '{' at position %d, use \\{ for literal brace", start-1)
+		case c == '}':
+			if body.Len() == 0 {
+				return 0, "", fmt.Errorf("empty key at position %d", start-1)
+			}
+			return i, body.String(), nil
+		default:
+			body.WriteByte(c)
+		}
+	}
+	return 0, "", fmt.Errorf("unmatched '{' at position %d, use \\{ for literal brace", start-1)
+}
+
+func newTemplateKey(raw string) (*templateKey, error) {
+	key := new(templateKey)
+	fields := splitEscaped(raw, '|')
+	path := splitEscaped(fields[0], ':')
+	key.path = strings.Split(path[0], "/")
+	if len(path) > 1 {
+		key.filters = append(key.filters, missingFilter(strings.Join(path[1:], ":")))
+	}
+	for _, f := range fields[1:] {
+		filter, err := newTemplateFilter(f)
+		if err != nil {
+			return nil, err
+		}
+		key.filters = append(key.filters, filter)
 	}
+	return key, nil
 }
@@ -0,0 +1,175 @@
+package plugin
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// templateFilter transforms template value. Found is false if value is missing in record.
+type templateFilter func(value string, found bool) (string, bool)
+
+type templateFuncBuilder func(args []string) (templateFilter, error)
+
+var templateFuncs = map[string]templateFuncBuilder{
+	"lower":   stringFunc(strings.ToLower),
+	"upper":   stringFunc(strings.ToUpper),
+	"trim":    trimFunc,
+	"replace": replaceFunc,
+	"hash":    hashFunc,
+	"default": defaultFunc,
+	"trunc":   truncFunc,
+}
+
+func newTemplateFilter(raw string) (templateFilter, error) {
+	fields := splitEscaped(raw, ':')
+	name, args := fields[0], fields[1:]
+	builder, ok := templateFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown template function %q", name)
+	}
+	filter, err := builder(args)
+	if err != nil {
+		return nil, fmt.Errorf("template function %q: %s", name, err.Error())
+	}
+	return filter, nil
+}
+
+func stringFunc(f func(string) string) templateFuncBuilder {
+	return func(args []string) (templateFilter, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("expected no arguments, got %d", len(args))
+		}
+		return func(value string, found bool) (string, bool) {
+			if !found {
+				return value, false
+			}
+			return f(value), true
+		}, nil
+	}
+}
+
+func trimFunc(args []string) (templateFilter, error) {
+	switch len(args) {
+	case 0:
+		return stringFunc(strings.TrimSpace)(nil)
+	case 1:
+		cutset := args[0]
+		return stringFunc(func(value string) string {
+			return strings.Trim(value, cutset)
+		})(nil)
+	default:
+		return nil, fmt.Errorf("expected at most 1 argument, got %d", len(args))
+	}
+}
+
+func replaceFunc(args []string) (templateFilter, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("expected pattern and optional replacement, got %d arguments", len(args))
+	}
+	reg, err := regexp.Compile(args[0])
+	if err != nil {
+		return nil, err
+	}
+	replacement := ""
+	if len(args) == 2 {
+		replacement = args[1]
+	}
+	return stringFunc(func(value string) string {
+		return reg.ReplaceAllString(value, replacement)
+	})(nil)
+}
+
+func hashFunc(args []string) (templateFilter, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("expected at most 1 argument, got %d", len(args))
+	}
+	algorithm := "sha256"
+	if len(args) == 1 {
+		algorithm = args[0]
+	}
+	var newHash func() hash.Hash
+	switch algorithm {
+	case "md5":
+		newHash = md5.New
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	case "fnv":
+		newHash = func() hash.Hash { return fnv.New64a() }
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm %q", algorithm)
+	}
+	return stringFunc(func(value string) string {
+		h := newHash()
+		_, _ = h.Write([]byte(value))
+		return hex.EncodeToString(h.Sum(nil))
+	})(nil)
+}
+
+func defaultFunc(args []string) (templateFilter, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("expected default value")
+	}
+	defaultValue := strings.Join(args, ":")
+	return func(value string, found bool) (string, bool) {
+		if !found || len(value) == 0 {
+			return defaultValue, true
+		}
+		return value, true
+	}, nil
+}
+
+// missingFilter is used for {path:default} syntax, unlike default function it keeps empty values.
+func missingFilter(defaultValue string) templateFilter {
+	return func(value string, found bool) (string, bool) {
+		if !found {
+			return defaultValue, true
+		}
+		return value, true
+	}
+}
+
+func truncFunc(args []string) (templateFilter, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected max length, got %d arguments", len(args))
+	}
+	maxLen, err := strconv.Atoi(args[0])
+	if err != nil || maxLen < 0 {
+		return nil, fmt.Errorf("invalid max length %q", args[0])
+	}
+	return stringFunc(func(value string) string {
+		runes := []rune(value)
+		if len(runes) <= maxLen {
+			return value
+		}
+		return string(runes[:maxLen])
+	})(nil)
+}
+
+// splitEscaped splits s by sep, unless sep is escaped with backslash.
+func splitEscaped(s string, sep byte) []string {
+	var parts []string
+	var cur strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == sep:
+			cur.WriteByte(sep)
+			i++
+		case s[i] == sep:
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	return append(parts, cur.String())
+}
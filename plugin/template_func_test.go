@@ -0,0 +1,58 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateFilter_Success(t *testing.T) {
+	tests := []struct {
+		filter   string
+		value    string
+		expected string
+	}{
+		{"lower", "ABC", "abc"},
+		{"upper", "abc", "ABC"},
+		{"trim", "  abc  ", "abc"},
+		{"trim:-", "--abc--", "abc"},
+		{"replace:[^a-z0-9-]+:-", "a_b.c", "a-b-c"},
+		{"replace:\\d", "a1b2", "ab"},
+		{"replace:\\::-", "a:b", "a-b"},
+		{"hash:md5", "abc", "900150983cd24fb0d6963f7d28e17f72"},
+		{"hash", "abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"default:unknown", "", "unknown"},
+		{"default:a:b", "", "a:b"},
+		{"default:unknown", "abc", "abc"},
+		{"trunc:3", "abcdef", "abc"},
+		{"trunc:2", "привет", "пр"},
+	}
+	for _, tt := range tests {
+		filter, err := newTemplateFilter(tt.filter)
+		assert.Nil(t, err, tt.filter)
+
+		value, found := filter(tt.value, true)
+
+		assert.True(t, found, tt.filter)
+		assert.Equal(t, tt.expected, value, tt.filter)
+	}
+}
+
+func TestTemplateFilter_NotFound_Success(t *testing.T) {
+	lower, _ := newTemplateFilter("lower")
+	_, found := lower("", false)
+	assert.False(t, found)
+
+	def, _ := newTemplateFilter("default:unknown")
+	value, found := def("", false)
+	assert.True(t, found)
+	assert.Equal(t, "unknown", value)
+}
+
+func TestTemplateFilter_Fail(t *testing.T) {
+	for _, raw := range []string{"unknown", "lower:arg", "replace", "replace:[", "hash:crc", "default", "trunc", "trunc:-1", "trunc:abc"} {
+		_, err := newTemplateFilter(raw)
+
+		assert.NotNil(t, err, raw)
+	}
+}
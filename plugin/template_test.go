@@ -6,27 +6,39 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+func mustNewTemplate(raw string) *template {
+	templ, err := newTemplate(raw)
+	if err != nil {
+		panic(err)
+	}
+	return templ
+}
+
 func TestNewTemplate_Success(t *testing.T) {
 	raw := "begin_{simple}_{path/to/json/value}_end"
 
-	templ := newTemplate(raw)
+	templ, err := newTemplate(raw)
 
-	format := "begin_%s_%s_end"
-	keys := [][]string{
-		{"simple"},
-		{"path", "to", "json", "value"},
+	tokens := []templateToken{
+		{literal: "begin_"},
+		{key: &templateKey{path: []string{"simple"}}},
+		{literal: "_"},
+		{key: &templateKey{path: []string{"path", "to", "json", "value"}}},
+		{literal: "_end"},
 	}
+	assert.Nil(t, err)
 	assert.NotNil(t, templ)
-	assert.Equal(t, format, templ.format)
-	assert.Equal(t, keys, templ.keys)
+	assert.Equal(t, tokens, templ.tokens)
 }
 
 func TestParse_Success(t *testing.T) {
 	templ := &template{
-		format: "begin_%s_%s_end",
-		keys: [][]string{
-			{"simple"},
-			{"path", "to"},
+		tokens: []templateToken{
+			{literal: "begin_"},
+			{key: &templateKey{path: []string{"simple"}}},
+			{literal: "_"},
+			{key: &templateKey{path: []string{"path", "to"}}},
+			{literal: "_end"},
 		},
 	}
 	record := map[interface{}]interface{}{
@@ -36,7 +48,7 @@ func TestParse_Success(t *testing.T) {
 		},
 	}
 
-	parsed, err := templ.parse(record)
+	parsed, err := templ.parse(toStruct(record), nil)
 
 	assert.Nil(t, err)
 	assert.Equal(t, "begin_simple_value_path_value_end", parsed)
@@ -44,12 +56,11 @@ func TestParse_Success(t *testing.T) {
 
 func TestParse_NotTemplated_Success(t *testing.T) {
 	templ := &template{
-		format: "begin_end",
-		keys:   [][]string{},
+		tokens: []templateToken{{literal: "begin_end"}},
 	}
 	record := map[interface{}]interface{}{}
 
-	parsed, err := templ.parse(record)
+	parsed, err := templ.parse(toStruct(record), nil)
 
 	assert.Nil(t, err)
 	assert.Equal(t, "begin_end", parsed)
@@ -57,10 +68,12 @@ func TestParse_NotTemplated_Success(t *testing.T) {
 
 func TestParse_Fail(t *testing.T) {
 	templ := &template{
-		format: "begin_%s_%s_end",
-		keys: [][]string{
-			{"simple"},
-			{"path", "to"},
+		tokens: []templateToken{
+			{literal: "begin_"},
+			{key: &templateKey{path: []string{"simple"}}},
+			{literal: "_"},
+			{key: &templateKey{path: []string{"path", "to"}}},
+			{literal: "_end"},
 		},
 	}
 	record := map[interface{}]interface{}{
@@ -68,7 +81,161 @@ func TestParse_Fail(t *testing.T) {
 		"path":   "path_value",
 	}
 
-	_, err := templ.parse(record)
+	_, err := templ.parse(toStruct(record), nil)
+
+	assert.NotNil(t, err)
+}
+
+func TestParse_Meta_Success(t *testing.T) {
+	templ := mustNewTemplate("{$meta/otel/trace_id}_{simple}")
+	record := map[interface{}]interface{}{
+		"simple": "simple_value",
+	}
+	meta := map[interface{}]interface{}{
+		"otel": map[interface{}]interface{}{
+			"trace_id": "trace",
+		},
+	}
+
+	parsed, err := templ.parse(toStruct(record), toStruct(meta))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "trace_simple_value", parsed)
+}
+
+func TestParse_NoMeta_Fail(t *testing.T) {
+	templ := mustNewTemplate("{$meta/otel/trace_id}")
+	record := map[interface{}]interface{}{
+		"otel": map[interface{}]interface{}{
+			"trace_id": "trace",
+		},
+	}
+
+	_, err := templ.parse(toStruct(record), nil)
+
+	assert.NotNil(t, err)
+}
+
+func TestParse_Filters_Success(t *testing.T) {
+	templ := mustNewTemplate("{pod|lower|replace:_:-|trunc:10}_{missing|upper|default:unknown}")
+	record := map[interface{}]interface{}{
+		"pod": "My_Pod_Name_123",
+	}
+
+	parsed, err := templ.parse(toStruct(record), nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "my-pod-nam_unknown", parsed)
+}
+
+func TestParse_FilterMissing_Fail(t *testing.T) {
+	templ := mustNewTemplate("{missing|lower}")
+
+	_, err := templ.parse(toStruct(map[interface{}]interface{}{}), nil)
+
+	assert.NotNil(t, err)
+}
+
+func TestNewTemplate_UnknownFilter_Fail(t *testing.T) {
+	_, err := newTemplate("{pod|unknown}")
+
+	assert.NotNil(t, err)
+}
+
+func TestParse_DefaultValue_Success(t *testing.T) {
+	templ := mustNewTemplate("{missing:unknown}_{empty:unknown}_{path/to:a:b|upper}")
+	record := map[interface{}]interface{}{
+		"empty": "",
+	}
+
+	parsed, err := templ.parse(toStruct(record), nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "unknown__A:B", parsed)
+}
+
+func TestParseStatic_Success(t *testing.T) {
+	templ := mustNewTemplate("begin_{simple}_{missing}_end")
+	record := map[interface{}]interface{}{
+		"simple": "simple_value",
+	}
+
+	parsed := templ.parseStatic(toStruct(record), nil)
+
+	assert.Equal(t, "begin_simple_value__end", parsed)
+}
+
+func TestParse_Escaping_Success(t *testing.T) {
+	templ := mustNewTemplate(`100%_\{literal\}_\\_{simple}_%s%d`)
+	record := map[interface{}]interface{}{
+		"simple": "simple_value",
+	}
+
+	parsed, err := templ.parse(toStruct(record), nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `100%_{literal}_\_simple_value_%s%d`, parsed)
+}
+
+func TestNewTemplate_EscapedKey_Success(t *testing.T) {
+	templ, err := newTemplate(`{key\}|default:\{\}}`)
+
+	assert.Nil(t, err)
+	parsed, err := templ.parse(toStruct(map[interface{}]interface{}{}), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "{}", parsed)
+	parsed, err = templ.parse(toStruct(map[interface{}]interface{}{"key}": "value"}), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "value", parsed)
+}
+
+func TestParseGroupID_Success(t *testing.T) {
+	tests := []struct {
+		raw       string
+		groupID   string
+		templated bool
+	}{
+		{"group", "group", false},
+		{`group_\{ns\}`, "group_{ns}", false},
+		{"group_{ns}", "", true},
+		{"{$meta/group}", "", true},
+	}
+	for _, tt := range tests {
+		groupID, templated, err := ParseGroupID(tt.raw)
+
+		assert.Nil(t, err, tt.raw)
+		assert.Equal(t, tt.groupID, groupID, tt.raw)
+		assert.Equal(t, tt.templated, templated, tt.raw)
+	}
+}
+
+func TestParseGroupID_Fail(t *testing.T) {
+	_, _, err := ParseGroupID("{ns|unknown}")
 
 	assert.NotNil(t, err)
 }
+
+func TestNewTemplate_UnmatchedBraces_Success(t *testing.T) {
+	tests := []struct {
+		raw    string
+		tokens []templateToken
+	}{
+		{"begin_{simple", []templateToken{{literal: "begin_{simple"}}},
+		{"{}", []templateToken{{literal: "{}"}}},
+		{"{a{b}}", []templateToken{{literal: "{a"}, {key: &templateKey{path: []string{"b"}}}, {literal: "}"}}},
+	}
+	for _, test := range tests {
+		templ, err := newTemplate(test.raw)
+
+		assert.Nil(t, err, test.raw)
+		assert.Equal(t, test.tokens, templ.tokens, test.raw)
+	}
+}
+
+func TestNewTemplate_Fail(t *testing.T) {
+	for _, raw := range []string{"{a|unknown}", "begin_{a|trunc:x}"} {
+		_, err := newTemplate(raw)
+
+		assert.NotNil(t, err, raw)
+	}
+}
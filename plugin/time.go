@@ -0,0 +1,200 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type timeParser func(raw interface{}) (time.Time, error)
+
+const (
+	timeFormatRFC3339     = "rfc3339"
+	timeFormatRFC3339Nano = "rfc3339nano"
+	timeFormatUnix        = "unix"
+	timeFormatUnixMillis  = "unix_ms"
+	timeFormatUnixMicros  = "unix_us"
+	timeFormatUnixNanos   = "unix_ns"
+)
+
+// newTimeParser returns parser for one of named formats, strptime-like pattern (if format contains '%')
+// or Go layout string. Empty format means RFC3339 for strings and Unix seconds for numbers.
+func newTimeParser(format string) (timeParser, error) {
+	switch strings.ToLower(format) {
+	case "":
+		return func(raw interface{}) (time.Time, error) {
+			switch raw.(type) {
+			case string, []byte:
+				return parseLayout(time.RFC3339Nano, raw)
+			default:
+				return parseUnix(raw, time.Second)
+			}
+		}, nil
+	case timeFormatRFC3339:
+		return layoutParser(time.RFC3339), nil
+	case timeFormatRFC3339Nano:
+		return layoutParser(time.RFC3339Nano), nil
+	case timeFormatUnix:
+		return unixParser(time.Second), nil
+	case timeFormatUnixMillis:
+		return unixParser(time.Millisecond), nil
+	case timeFormatUnixMicros:
+		return unixParser(time.Microsecond), nil
+	case timeFormatUnixNanos:
+		return unixParser(time.Nanosecond), nil
+	}
+
+	layout := format
+	if strings.Contains(format, "%") {
+		var err error
+		layout, err = strptimeToLayout(format)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := validateLayout(layout); err != nil {
+		return nil, err
+	}
+	return layoutParser(layout), nil
+}
+
+// validateLayout checks that layout has date elements and parses time formatted with it,
+// so that a typo in named format, i.e. rfc3999, isn't taken for a layout which never matches.
+func validateLayout(layout string) error {
+	day := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	formatted := day.Format(layout)
+	if formatted == day.AddDate(0, 0, 1).Format(layout) {
+		return fmt.Errorf("unknown time format %q: neither named format nor layout with date", layout)
+	}
+	if _, err := time.Parse(layout, formatted); err != nil {
+		return fmt.Errorf("invalid time layout %q: %s", layout, err.Error())
+	}
+	return nil
+}
+
+func layoutParser(layout string) timeParser {
+	return func(raw interface{}) (time.Time, error) {
+		return parseLayout(layout, raw)
+	}
+}
+
+func unixParser(unit time.Duration) timeParser {
+	return func(raw interface{}) (time.Time, error) {
+		return parseUnix(raw, unit)
+	}
+}
+
+func parseLayout(layout string, raw interface{}) (time.Time, error) {
+	switch raw.(type) {
+	case string, []byte:
+		return time.Parse(layout, toString(raw))
+	default:
+		return time.Time{}, fmt.Errorf("expected string time value, got %T", raw)
+	}
+}
+
+func parseUnix(raw interface{}, unit time.Duration) (time.Time, error) {
+	switch typed := raw.(type) {
+	case string, []byte:
+		str := strings.TrimSpace(toString(typed))
+		if i, err := strconv.ParseInt(str, 10, 64); err == nil {
+			return unixTime(i, unit), nil
+		}
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid numeric time value %q", str)
+		}
+		return unixTimeFloat(f, unit), nil
+	case int:
+		return unixTime(int64(typed), unit), nil
+	case int8:
+		return unixTime(int64(typed), unit), nil
+	case int16:
+		return unixTime(int64(typed), unit), nil
+	case int32:
+		return unixTime(int64(typed), unit), nil
+	case int64:
+		return unixTime(typed, unit), nil
+	case uint:
+		return unixTime(int64(typed), unit), nil
+	case uint8:
+		return unixTime(int64(typed), unit), nil
+	case uint16:
+		return unixTime(int64(typed), unit), nil
+	case uint32:
+		return unixTime(int64(typed), unit), nil
+	case uint64:
+		if typed > math.MaxInt64 {
+			return time.Time{}, fmt.Errorf("time value %d out of range", typed)
+		}
+		return unixTime(int64(typed), unit), nil
+	case float32:
+		return unixTimeFloat(float64(typed), unit), nil
+	case float64:
+		return unixTimeFloat(typed, unit), nil
+	default:
+		return time.Time{}, fmt.Errorf("expected numeric time value, got %T", raw)
+	}
+}
+
+func unixTime(value int64, unit time.Duration) time.Time {
+	perSecond := int64(time.Second / unit)
+	return time.Unix(value/perSecond, (value%perSecond)*int64(unit))
+}
+
+func unixTimeFloat(value float64, unit time.Duration) time.Time {
+	whole, frac := math.Modf(value)
+	return unixTime(int64(whole), unit).Add(time.Duration(math.Round(frac * float64(unit))))
+}
+
+var strptimeDirectives = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'j': "002",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'L': "999999999",
+	'f': "999999999",
+	'p': "PM",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'z': "-0700",
+	'Z': "MST",
+	'T': "15:04:05",
+	'F': "2006-01-02",
+	'D': "01/02/06",
+	'R': "15:04",
+	'%': "%",
+}
+
+// strptimeToLayout converts strptime-like pattern (e.g. "%Y-%m-%d %H:%M:%S") to Go layout.
+func strptimeToLayout(format string) (string, error) {
+	var layout strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			layout.WriteByte(format[i])
+			continue
+		}
+		if i+1 >= len(format) {
+			return "", errors.New("time format ends with incomplete directive")
+		}
+		i++
+		directive, ok := strptimeDirectives[format[i]]
+		if !ok {
+			return "", fmt.Errorf("unsupported time format directive %%%c", format[i])
+		}
+		layout.WriteString(directive)
+	}
+	return layout.String(), nil
+}
@@ -0,0 +1,99 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTimeParser_Default_Success(t *testing.T) {
+	parser, err := newTimeParser("")
+	assert.Nil(t, err)
+
+	parsed, err := parser("2023-07-01T10:20:30.123456789Z")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2023, 7, 1, 10, 20, 30, 123456789, time.UTC), parsed.UTC())
+
+	parsed, err = parser(uint64(1688206830))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1688206830), parsed.Unix())
+}
+
+func TestNewTimeParser_RFC3339_Success(t *testing.T) {
+	parser, err := newTimeParser("RFC3339")
+	assert.Nil(t, err)
+
+	parsed, err := parser([]byte("2023-07-01T10:20:30+03:00"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2023, 7, 1, 7, 20, 30, 0, time.UTC), parsed.UTC())
+}
+
+func TestNewTimeParser_Unix_Success(t *testing.T) {
+	tests := []struct {
+		format   string
+		raw      interface{}
+		expected time.Time
+	}{
+		{"unix", int64(1688206830), time.Unix(1688206830, 0)},
+		{"unix", 1688206830.25, time.Unix(1688206830, 250000000)},
+		{"unix", "1688206830", time.Unix(1688206830, 0)},
+		{"unix_ms", uint64(1688206830123), time.Unix(1688206830, 123000000)},
+		{"unix_ms", "1688206830123", time.Unix(1688206830, 123000000)},
+		{"unix_us", int64(1688206830123456), time.Unix(1688206830, 123456000)},
+		{"unix_ns", int64(1688206830123456789), time.Unix(1688206830, 123456789)},
+	}
+	for _, tt := range tests {
+		parser, err := newTimeParser(tt.format)
+		assert.Nil(t, err)
+
+		parsed, err := parser(tt.raw)
+
+		assert.Nil(t, err, tt.format)
+		assert.True(t, tt.expected.Equal(parsed), "%s: expected %s, got %s", tt.format, tt.expected, parsed)
+	}
+}
+
+func TestNewTimeParser_GoLayout_Success(t *testing.T) {
+	parser, err := newTimeParser("2006-01-02 15:04:05")
+	assert.Nil(t, err)
+
+	parsed, err := parser("2023-07-01 10:20:30")
+
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2023, 7, 1, 10, 20, 30, 0, time.UTC), parsed)
+}
+
+func TestNewTimeParser_Strptime_Success(t *testing.T) {
+	parser, err := newTimeParser("%d/%b/%Y:%H:%M:%S.%L %z")
+	assert.Nil(t, err)
+
+	parsed, err := parser("01/Jul/2023:10:20:30.500 +0300")
+
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2023, 7, 1, 7, 20, 30, 500000000, time.UTC), parsed.UTC())
+}
+
+func TestNewTimeParser_Strptime_Fail(t *testing.T) {
+	_, err := newTimeParser("%Y-%Q")
+
+	assert.NotNil(t, err)
+}
+
+func TestNewTimeParser_Fail(t *testing.T) {
+	parser, err := newTimeParser("unix")
+	assert.Nil(t, err)
+
+	_, err = parser("not a number")
+
+	assert.NotNil(t, err)
+}
+
+func TestNewTimeParser_Layout_Fail(t *testing.T) {
+	for _, format := range []string{"rfc3999", "unix_sec", "timestamp", "15:04:05"} {
+		_, err := newTimeParser(format)
+
+		assert.NotNil(t, err, format)
+	}
+}
@@ -1,53 +1,95 @@
 package plugin
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/fluent/fluent-bit-go/output"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
-func getRecordValue(record map[interface{}]interface{}, path []string) (string, error) {
-	var cur interface{} = record
+func getRecordValue(record *structpb.Struct, path []string) (string, error) {
+	cur := structpb.NewStructValue(record)
 	for _, p := range path {
-		switch typed := cur.(type) {
-		case map[interface{}]interface{}:
-			cur = typed[p]
-		case []interface{}:
+		switch cur.GetKind().(type) {
+		case *structpb.Value_StructValue:
+			cur = cur.GetStructValue().GetFields()[p]
+		case *structpb.Value_ListValue:
+			values := cur.GetListValue().GetValues()
 			index, err := strconv.Atoi(p)
 			if err != nil {
 				return "", fmt.Errorf("incorrect path: expected number instead of %q", p)
 			}
-			if index >= len(typed) {
+			if index >= len(values) {
 				return "", fmt.Errorf("incorrect path: index %q out of bound", p)
 			}
-			cur = typed[index]
+			cur = values[index]
 		default:
 			return "", fmt.Errorf("incorrect path")
 		}
 	}
-	if cur == nil {
+	if _, isNull := cur.GetKind().(*structpb.Value_NullValue); cur == nil || isNull {
 		return "", errors.New("incorrect path")
 	}
 
-	switch cur.(type) {
-	case string, []byte:
-		return toString(cur), nil
-	default:
-		value, err := structpb.NewValue(normalize(cur))
-		if err != nil {
-			return "", fmt.Errorf("failed to create protobuf value to marshal JSON: %s", err.Error())
-		}
-		content, err := value.MarshalJSON()
-		if err != nil {
-			return "", fmt.Errorf("failed to marshal JSON: %s", err.Error())
+	return valueString(cur), nil
+}
+
+// valueString returns string values as is and JSON for all the others.
+func valueString(value *structpb.Value) string {
+	if _, ok := value.GetKind().(*structpb.Value_StringValue); ok {
+		return value.GetStringValue()
+	}
+	content, err := value.MarshalJSON()
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
+
+// parseJSONObject returns nil unless value is a string with JSON object.
+func parseJSONObject(value *structpb.Value) *structpb.Struct {
+	str := strings.TrimSpace(value.GetStringValue())
+	if !strings.HasPrefix(str, "{") {
+		return nil
+	}
+	object := new(structpb.Struct)
+	if err := object.UnmarshalJSON([]byte(str)); err != nil {
+		return nil
+	}
+	return object
+}
+
+// kinds of warnings printed once per chunk
+const (
+	warningEventTime = "event_time"
+	warningTimeKey   = "time_key"
+)
+
+// chunkWarnings prints every kind of warning once per chunk, so that invalid records don't flood the log.
+// Nil warnings print all of them.
+type chunkWarnings struct {
+	printed map[string]bool
+}
+
+func newChunkWarnings() *chunkWarnings {
+	return &chunkWarnings{printed: make(map[string]bool)}
+}
+
+func (w *chunkWarnings) printf(kind string, format string, args ...interface{}) {
+	if w != nil {
+		if w.printed[kind] {
+			return
 		}
-		return string(content), nil
+		w.printed[kind] = true
 	}
+	fmt.Printf(format, args...)
 }
 
 func toString(raw interface{}) string {
@@ -61,63 +103,102 @@ func toString(raw interface{}) string {
 	}
 }
 
-func toTime(raw interface{}) time.Time {
+// toTime supports all Fluent Bit event time encodings: EventTime extension, integer or float seconds
+// and fluent-bit 2.1+ event group header (time, metadata).
+func toTime(raw interface{}) (time.Time, error) {
 	switch typed := raw.(type) {
 	case output.FLBTime:
-		return typed.Time
-	case uint64:
-		return time.Unix(int64(typed), 0)
-	case []interface{}:
-		if dt, ok := typed[0].(output.FLBTime); ok {
-			return dt.Time
-		}
-		fmt.Printf("provided time (%+v) invalid: defaulting to now.\n", typed)
-		return time.Now()
-	default:
-		fmt.Printf("provided time (%+v) invalid: defaulting to now.\n", typed)
-		return time.Now()
-	}
-}
-
-func normalize(raw interface{}) interface{} {
-	switch typed := raw.(type) {
+		return typed.Time, nil
+	case *output.FLBTime:
+		return typed.Time, nil
+	case time.Time:
+		return typed, nil
 	case []byte:
-		if utf8.Valid(typed) {
-			return string(typed)
+		// EventTime extension payload, if it wasn't decoded
+		if len(typed) != 8 {
+			return time.Time{}, fmt.Errorf("provided time (%v) invalid: expected 8 bytes, got %d", typed, len(typed))
 		}
-		return typed
+		sec := binary.BigEndian.Uint32(typed)
+		nsec := binary.BigEndian.Uint32(typed[4:])
+		return time.Unix(int64(sec), int64(nsec)), nil
 	case []interface{}:
 		if len(typed) == 0 {
-			return typed
-		}
-		valSlice := make([]interface{}, 0, len(typed))
-		for _, el := range typed {
-			valSlice = append(valSlice, normalize(el))
-		}
-		return valSlice
-	case map[interface{}]interface{}:
-		if len(typed) == 0 {
-			if typed == nil {
-				return nil
-			}
-			return map[string]interface{}{}
+			return time.Time{}, errors.New("provided time invalid: empty event header")
 		}
-		valMap := make(map[string]interface{}, len(typed))
-		for key, val := range typed {
-			if keyStr, ok := normalize(key).(string); ok {
-				valMap[keyStr] = normalize(val)
-			}
+		return toTime(typed[0])
+	default:
+		ts, err := parseUnix(raw, time.Second)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("provided time (%+v) invalid: %s", typed, err.Error())
 		}
-		return valMap
+		return ts, nil
+	}
+}
+
+// isGroupMarker reports whether event time is negative, which marks start (-1) and end (-2)
+// of Fluent Bit event group. Markers carry group metadata only and aren't written as entries.
+func isGroupMarker(rawTime interface{}) bool {
+	if header, ok := rawTime.([]interface{}); ok && len(header) > 0 {
+		rawTime = header[0]
+	}
+	switch typed := rawTime.(type) {
+	case int64:
+		return typed < 0
+	case int32:
+		return typed < 0
+	case int16:
+		return typed < 0
+	case int8:
+		return typed < 0
+	case int:
+		return typed < 0
 	default:
-		return raw
+		return false
 	}
 }
 
-// truncate requires maxLen to be >= 3 (for '...')
+// truncate requires maxLen to be >= 3 (for '...'), the result is cut at character boundary.
 func truncate(str string, maxLen int) string {
 	if len(str) <= maxLen {
 		return str
 	}
-	return str[:maxLen-3] + "..."
+	head, _ := cutUTF8(str, maxLen-3)
+	return head + "..."
+}
+
+const zeroWidthJoiner = '\u200d'
+
+// cutUTF8 splits s within maxBytes at character boundary. It also avoids splitting
+// common grapheme clusters: combining marks, variation selectors, emoji modifiers
+// and ZWJ sequences stay with their base character, unless the cluster alone exceeds maxBytes.
+func cutUTF8(s string, maxBytes int) (string, string) {
+	if len(s) <= maxBytes {
+		return s, ""
+	}
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	for cluster := end; cluster > 0; {
+		next, _ := utf8.DecodeRuneInString(s[cluster:])
+		prev, size := utf8.DecodeLastRuneInString(s[:cluster])
+		if !isGraphemeExtend(next) && prev != zeroWidthJoiner {
+			end = cluster
+			break
+		}
+		cluster -= size
+	}
+	return s[:end], s[end:]
+}
+
+// isGraphemeExtend reports whether r doesn't start a new grapheme cluster.
+func isGraphemeExtend(r rune) bool {
+	switch {
+	case r == zeroWidthJoiner,
+		r >= 0xfe00 && r <= 0xfe0f,   // variation selectors
+		r >= 0x1f3fb && r <= 0x1f3ff, // emoji skin tone modifiers
+		r >= 0xe0020 && r <= 0xe007f: // emoji tag sequences
+		return true
+	}
+	return unicode.In(r, unicode.Mn, unicode.Me)
 }
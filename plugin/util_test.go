@@ -1,9 +1,14 @@
 package plugin
 
 import (
+	"io"
+	"os"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	"github.com/fluent/fluent-bit-go/output"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,7 +20,7 @@ func TestGetRecordValue_Success(t *testing.T) {
 	}
 	path := []string{"a", "b"}
 
-	val, err := getRecordValue(record, path)
+	val, err := getRecordValue(toStruct(record), path)
 
 	assert.Nil(t, err)
 	assert.Equal(t, "value", val)
@@ -27,7 +32,7 @@ func TestGetRecordValue_WithArray_Success(t *testing.T) {
 	}
 	path := []string{"a", "0"}
 
-	val, err := getRecordValue(record, path)
+	val, err := getRecordValue(toStruct(record), path)
 
 	assert.Nil(t, err)
 	assert.Equal(t, "value", val)
@@ -44,7 +49,7 @@ func TestGetRecordValue_JSONValue_Success(t *testing.T) {
 	}
 	path := []string{"a", "b"}
 
-	val, err := getRecordValue(record, path)
+	val, err := getRecordValue(toStruct(record), path)
 
 	assert.Nil(t, err)
 	val = strings.ReplaceAll(val, " ", "") // hack
@@ -57,7 +62,7 @@ func TestGetRecordValue_Fail(t *testing.T) {
 	}
 	path := []string{"a", "b"}
 
-	_, err := getRecordValue(record, path)
+	_, err := getRecordValue(toStruct(record), path)
 
 	assert.NotNil(t, err)
 }
@@ -70,7 +75,7 @@ func TestGetRecordValue_NoSuchKey_Fail(t *testing.T) {
 	}
 	path := []string{"a", "b"}
 
-	_, err := getRecordValue(record, path)
+	_, err := getRecordValue(toStruct(record), path)
 
 	assert.NotNil(t, err)
 }
@@ -81,7 +86,7 @@ func TestGetRecordValue_WithArray_Fail(t *testing.T) {
 	}
 	path := []string{"a", "b"}
 
-	_, err := getRecordValue(record, path)
+	_, err := getRecordValue(toStruct(record), path)
 
 	assert.NotNil(t, err)
 }
@@ -92,7 +97,147 @@ func TestGetRecordValue_WithArray_OutOfBound_Fail(t *testing.T) {
 	}
 	path := []string{"a", "1"}
 
-	_, err := getRecordValue(record, path)
+	_, err := getRecordValue(toStruct(record), path)
 
 	assert.NotNil(t, err)
 }
+
+func TestToTime_Success(t *testing.T) {
+	expected := time.Unix(1688206830, 123456789)
+	tests := []interface{}{
+		output.FLBTime{Time: expected},
+		[]byte{0x64, 0x9f, 0xfd, 0xee, 0x07, 0x5b, 0xcd, 0x15},
+		1688206830.123456789,
+		[]interface{}{output.FLBTime{Time: expected}, map[interface{}]interface{}{}},
+	}
+	for _, raw := range tests {
+		ts, err := toTime(raw)
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected.Unix(), ts.Unix())
+		assert.InDelta(t, expected.Nanosecond(), ts.Nanosecond(), 1000, "%T", raw)
+	}
+}
+
+func TestToTime_Integer_Success(t *testing.T) {
+	for _, raw := range []interface{}{uint64(1688206830), int64(1688206830), uint32(1688206830)} {
+		ts, err := toTime(raw)
+
+		assert.Nil(t, err)
+		assert.Equal(t, time.Unix(1688206830, 0), ts)
+	}
+}
+
+func TestToTime_Fail(t *testing.T) {
+	for _, raw := range []interface{}{nil, []interface{}{}, []byte{0x01}, map[interface{}]interface{}{}} {
+		_, err := toTime(raw)
+
+		assert.NotNil(t, err)
+	}
+}
+
+func TestEventMetadata_Success(t *testing.T) {
+	meta := map[interface{}]interface{}{"otel": "value"}
+
+	assert.Equal(t, meta, eventMetadata([]interface{}{output.FLBTime{}, meta}))
+	assert.Nil(t, eventMetadata([]interface{}{output.FLBTime{}}))
+	assert.Nil(t, eventMetadata(output.FLBTime{}))
+}
+
+func TestCutUTF8_Success(t *testing.T) {
+	tests := []struct {
+		s        string
+		maxBytes int
+		head     string
+		tail     string
+	}{
+		{"hello", 10, "hello", ""},
+		{"hello", 3, "hel", "lo"},
+		// each Cyrillic letter takes 2 bytes
+		{"привет", 5, "пр", "ивет"},
+		{"привет", 4, "пр", "ивет"},
+		{"a😀b", 4, "a", "😀b"},
+		{"a😀b", 5, "a😀", "b"},
+		// combining acute accent
+		{"ие́", 4, "и", "е́"},
+		// emoji with skin tone modifier
+		{"a👍🏽", 8, "a", "👍🏽"},
+		// family emoji joined with ZWJ
+		{"a👩‍👧", 9, "a", "👩‍👧"},
+		// cluster longer than maxBytes is cut at character boundary
+		{"👍🏽", 6, "👍", "🏽"},
+	}
+	for _, test := range tests {
+		head, tail := cutUTF8(test.s, test.maxBytes)
+
+		assert.Equal(t, test.head, head, test.s)
+		assert.Equal(t, test.tail, tail, test.s)
+	}
+}
+
+func TestTruncate_Success(t *testing.T) {
+	tests := []struct {
+		str      string
+		maxLen   int
+		expected string
+	}{
+		{"short", 10, "short"},
+		{"abcdefgh", 6, "abc..."},
+		{"ошибка", 8, "ош..."},
+		{"ошибка", 10, "оши..."},
+		{"ok😀😀", 9, "ok😀..."},
+		{"ok😀😀", 8, "ok..."},
+		{"ok👍🏽", 9, "ok..."},
+	}
+	for _, test := range tests {
+		truncated := truncate(test.str, test.maxLen)
+
+		assert.Equal(t, test.expected, truncated, test.str)
+		assert.True(t, utf8.ValidString(truncated), test.str)
+		assert.LessOrEqual(t, len(truncated), test.maxLen, test.str)
+	}
+	assert.Equal(t, 511, len(truncate(strings.Repeat("я", 1000), 512)))
+	assert.Equal(t, 512, len(truncate("x"+strings.Repeat("я", 1000), 512)))
+}
+
+// captureStdout returns output printed by f.
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	f()
+
+	assert.Nil(t, w.Close())
+	out, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	return string(out)
+}
+
+func TestChunkWarnings_Success(t *testing.T) {
+	out := captureStdout(t, func() {
+		warnings := newChunkWarnings()
+		for i := 0; i < 3; i++ {
+			warnings.printf(warningTimeKey, "time %d\n", i)
+			warnings.printf(warningEventTime, "event %d\n", i)
+		}
+		var all *chunkWarnings
+		all.printf(warningTimeKey, "all\n")
+		all.printf(warningTimeKey, "all\n")
+	})
+
+	assert.Equal(t, "time 0\nevent 0\nall\nall\n", out)
+}
+
+func TestIsGroupMarker_Success(t *testing.T) {
+	meta := map[interface{}]interface{}{"group": "value"}
+
+	assert.True(t, isGroupMarker([]interface{}{int64(-1), meta}))
+	assert.True(t, isGroupMarker([]interface{}{int64(-2), meta}))
+	assert.True(t, isGroupMarker(int64(-1)))
+	assert.False(t, isGroupMarker([]interface{}{output.FLBTime{}, meta}))
+	assert.False(t, isGroupMarker(uint64(1688206830)))
+	assert.False(t, isGroupMarker([]interface{}{}))
+}
@@ -3,49 +3,189 @@ package plugin
 import (
 	"context"
 	"fmt"
+	"sort"
 
+	"github.com/fluent/fluent-bit-go/output"
+	"google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
 
 	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
 )
 
-func (p *Plugin) WriteAll(resourceToEntries map[model.Resource][]*model.Entry) (results chan error, resCount int) {
-	const batchMaxLen = 100
+type batch struct {
+	key     model.BatchKey
+	entries []*model.Entry
+}
+
+const defaultBatchMaxLen = 100
+
+// Flush writes entries and returns Fluent Bit flush result code,
+// in async mode entries are queued and FLB_RETRY is returned if the queue is full.
+func (p *Plugin) Flush(keyToEntries map[model.BatchKey][]*model.Entry) int {
+	p.closeMu.RLock()
+	if p.closing {
+		p.closeMu.RUnlock()
+		return output.FLB_RETRY
+	}
+	p.inFlight.Add(1)
+	p.closeMu.RUnlock()
+	defer p.inFlight.Done()
+
+	if p.multiline != nil {
+		// entries held by multiline are sent later, so they aren't retried by Fluent Bit
+		keyToEntries = p.multiline.join(keyToEntries)
+	}
+	// messages are limited after they are joined
+	keyToEntries = p.messageLimit.apply(keyToEntries)
+	if p.async == nil {
+		return p.send(keyToEntries)
+	}
+	if len(keyToEntries) == 0 {
+		return output.FLB_OK
+	}
+	if !p.async.enqueue(keyToEntries) {
+		fmt.Printf("yc-logging: async queue is full, retrying %d entries later\n", countEntries(keyToEntries))
+		return output.FLB_RETRY
+	}
+	return output.FLB_OK
+}
+
+// flushJoined sends entries released by multiline outside of Fluent Bit flush,
+// they are written right away if async queue is full. Fluent Bit doesn't retry these entries,
+// so they are retried until writes are interrupted on exit and passed to unsent then.
+func (p *Plugin) flushJoined(keyToEntries map[model.BatchKey][]*model.Entry) {
+	keyToEntries = p.messageLimit.apply(keyToEntries)
+	if p.async != nil && p.async.enqueue(keyToEntries) {
+		return
+	}
+	if code := sendWithRetry(keyToEntries, p.send, p.writeContext().Done(), p.unsent); code == output.FLB_ERROR {
+		fmt.Printf("yc-logging: failed to send %d joined entries\n", countEntries(keyToEntries))
+	}
+}
+
+func (p *Plugin) send(keyToEntries map[model.BatchKey][]*model.Entry) int {
+	results, resCount := p.WriteAll(keyToEntries)
+
+	for i := 0; i < resCount; i++ {
+		err := <-results
+		if err == nil {
+			continue
+		}
+
+		code := grpcstatus.Code(err)
+		if code == codes.Unknown {
+			// i.e., rate limiter wait interrupted on exit
+			code = grpcstatus.FromContextError(err).Code()
+		}
+		switch code {
+		case codes.PermissionDenied:
+			// kick client reinit
+			fmt.Printf("yc-logging: reinit on write error %s: %q\n", code.String(), err.Error())
+			if initErr := p.InitClient(); initErr != nil {
+				fmt.Printf("yc-logging: reinit failed: %q\n", initErr.Error())
+			} else {
+				fmt.Printf("yc-logging: reinit succeded\n")
+			}
+			return output.FLB_RETRY
+		case codes.ResourceExhausted, codes.FailedPrecondition, codes.Unavailable,
+			codes.Canceled, codes.DeadlineExceeded:
+			fmt.Printf("yc-logging: write retriable error %s: %q\n", code.String(), err.Error())
+			return output.FLB_RETRY
+		default:
+			fmt.Printf("yc-logging: write failed %s: %q\n", code.String(), err.Error())
+			return output.FLB_ERROR
+		}
+	}
+
+	return output.FLB_OK
+}
+
+func (p *Plugin) WriteAll(keyToEntries map[model.BatchKey][]*model.Entry) (results chan error, resCount int) {
+	batchMaxLen := defaultBatchMaxLen
+	if p.aimd != nil {
+		batchMaxLen = p.aimd.currentBatchSize()
+	}
 	resCount = 0
-	for _, entries := range resourceToEntries {
+	for _, entries := range keyToEntries {
 		resCount += (len(entries) + batchMaxLen - 1) / batchMaxLen
 	}
 	results = make(chan error, resCount)
 
-	for resource, entries := range resourceToEntries {
-		resource := resource
-		entries := entries
+	ctx := p.writeContext()
+	for _, group := range p.batchGroups(keyToEntries, batchMaxLen) {
+		p.inFlight.Add(1)
+		go func(batches []*batch, res chan error) {
+			defer p.inFlight.Done()
+			// batches in group are sent sequentially, the rest of them are skipped after an error
+			var err error
+			for _, b := range batches {
+				if err == nil {
+					err = p.write(ctx, b.entries, &b.key)
+				}
+				res <- err
+			}
+		}(group, results)
+	}
+
+	return results, resCount
+}
+
+// batchGroups splits entries into batches and groups them for sequential sending:
+// by destination and resource if order should be preserved, one batch per group otherwise.
+func (p *Plugin) batchGroups(keyToEntries map[model.BatchKey][]*model.Entry, batchMaxLen int) [][]*batch {
+	groups := make([][]*batch, 0)
+	groupIndex := make(map[model.BatchKey]int)
+	for _, key := range sortedBatchKeys(keyToEntries) {
+		entries := keyToEntries[key]
+		groupKey := model.BatchKey{Destination: key.Destination, Resource: key.Resource}
 
 		for len(entries) > 0 {
-			var batch []*model.Entry
+			b := &batch{key: key}
 			if len(entries) > batchMaxLen {
-				batch, entries = entries[:batchMaxLen], entries[batchMaxLen:]
+				b.entries, entries = entries[:batchMaxLen], entries[batchMaxLen:]
 			} else {
-				batch, entries = entries, nil
+				b.entries, entries = entries, nil
 			}
 
-			go func(res chan error) {
-				err := p.write(context.Background(), batch, &resource)
-				res <- err
-			}(results)
+			idx, ok := groupIndex[groupKey]
+			if !p.writeOpts.preserveOrder || !ok {
+				idx = len(groups)
+				groupIndex[groupKey] = idx
+				groups = append(groups, nil)
+			}
+			groups[idx] = append(groups[idx], b)
 		}
 	}
-
-	return results, resCount
+	return groups
 }
 
-func (p *Plugin) write(ctx context.Context, entries []*model.Entry, resource *model.Resource) error {
+func (p *Plugin) write(ctx context.Context, entries []*model.Entry, key *model.BatchKey) error {
+	var destination *model.Destination
+	if key.Destination != (model.Destination{}) {
+		destination = &key.Destination
+	}
+
 	toSend := entries
 	for len(toSend) > 0 {
+		if p.limiter != nil {
+			if err := p.limiter.acquire(ctx, key.Destination, toSend); err != nil {
+				return err
+			}
+		}
+		if p.aimd != nil {
+			if err := p.aimd.acquire(ctx); err != nil {
+				return err
+			}
+		}
 		failed, err := p.client.Write(ctx, &model.WriteRequest{
-			Resource: resource,
-			Entries:  toSend,
+			Destination: destination,
+			Resource:    &key.Resource,
+			Entries:     toSend,
 		})
+		if p.aimd != nil {
+			p.aimd.release(isThrottled(failed, err))
+		}
 		if err != nil {
 			// return right away
 			return err
@@ -73,3 +213,43 @@ func (p *Plugin) write(ctx context.Context, entries []*model.Entry, resource *mo
 	}
 	return nil
 }
+
+// sortedBatchKeys returns keys ordered by destination, resource and stream name.
+func sortedBatchKeys(keyToEntries map[model.BatchKey][]*model.Entry) []model.BatchKey {
+	keys := make([]model.BatchKey, 0, len(keyToEntries))
+	for key := range keyToEntries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return batchKeyLess(keys[i], keys[j])
+	})
+	return keys
+}
+
+func batchKeyLess(a, b model.BatchKey) bool {
+	fields := [][2]string{
+		{a.Destination.LogGroupID, b.Destination.LogGroupID},
+		{a.Destination.FolderID, b.Destination.FolderID},
+		{a.Resource.Type, b.Resource.Type},
+		{a.Resource.ID, b.Resource.ID},
+		{a.StreamName, b.StreamName},
+	}
+	for _, f := range fields {
+		if f[0] != f[1] {
+			return f[0] < f[1]
+		}
+	}
+	return false
+}
+
+func isThrottled(failed map[int64]*status.Status, err error) bool {
+	if err != nil {
+		return grpcstatus.Code(err) == codes.ResourceExhausted
+	}
+	for _, failure := range failed {
+		if codes.Code(failure.GetCode()) == codes.ResourceExhausted {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+type recordingClient struct {
+	mu       sync.Mutex
+	requests []*model.WriteRequest
+	closed   bool
+	write    func(req *model.WriteRequest) (map[int64]*status.Status, error)
+}
+
+func (c *recordingClient) Write(_ context.Context, in *model.WriteRequest, _ ...grpc.CallOption) (map[int64]*status.Status, error) {
+	var failed map[int64]*status.Status
+	var err error
+	if c.write != nil {
+		failed, err = c.write(in)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, in)
+	return failed, err
+}
+
+func (c *recordingClient) Init(string, string, string) error {
+	return nil
+}
+
+func (c *recordingClient) Close(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *recordingClient) requestCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.requests)
+}
+
+func makeEntries(count int) []*model.Entry {
+	entries := make([]*model.Entry, count)
+	for i := range entries {
+		entries[i] = &model.Entry{Message: strconv.Itoa(i)}
+	}
+	return entries
+}
+
+func waitResults(t *testing.T, results chan error, resCount int) {
+	for i := 0; i < resCount; i++ {
+		assert.Nil(t, <-results)
+	}
+}
+
+func TestSortedBatchKeys_Success(t *testing.T) {
+	keys := []model.BatchKey{
+		{Destination: model.Destination{LogGroupID: "b"}},
+		{Destination: model.Destination{LogGroupID: "a"}, Resource: model.Resource{Type: "t", ID: "2"}},
+		{Destination: model.Destination{LogGroupID: "a"}, Resource: model.Resource{Type: "t", ID: "1"}, StreamName: "s2"},
+		{Destination: model.Destination{LogGroupID: "a"}, Resource: model.Resource{Type: "t", ID: "1"}, StreamName: "s1"},
+		{},
+	}
+	keyToEntries := make(map[model.BatchKey][]*model.Entry)
+	for _, key := range keys {
+		keyToEntries[key] = nil
+	}
+
+	sorted := sortedBatchKeys(keyToEntries)
+
+	assert.Equal(t, []model.BatchKey{keys[4], keys[3], keys[2], keys[1], keys[0]}, sorted)
+}
+
+func TestWriteAll_Success(t *testing.T) {
+	client := &recordingClient{}
+	plugin := Plugin{client: client}
+	keyToEntries := map[model.BatchKey][]*model.Entry{
+		{Resource: model.Resource{ID: "1"}}: makeEntries(250),
+		{Destination: model.Destination{LogGroupID: "group"}, Resource: model.Resource{ID: "2"}}: makeEntries(10),
+	}
+
+	results, resCount := plugin.WriteAll(keyToEntries)
+	waitResults(t, results, resCount)
+
+	assert.Equal(t, 4, resCount)
+	assert.Equal(t, 4, len(client.requests))
+	total := 0
+	for _, req := range client.requests {
+		total += len(req.Entries)
+		if req.Resource.ID == "2" {
+			assert.Equal(t, &model.Destination{LogGroupID: "group"}, req.Destination)
+		} else {
+			assert.Nil(t, req.Destination)
+		}
+	}
+	assert.Equal(t, 260, total)
+}
+
+func TestWriteAll_PreserveOrder_Success(t *testing.T) {
+	client := &recordingClient{
+		write: func(req *model.WriteRequest) (map[int64]*status.Status, error) {
+			// the first batch is the slowest one
+			if req.Entries[0].Message == "0" {
+				time.Sleep(50 * time.Millisecond)
+			}
+			return nil, nil
+		},
+	}
+	plugin := Plugin{client: client, writeOpts: writeOptions{preserveOrder: true}}
+	keyToEntries := map[model.BatchKey][]*model.Entry{
+		{Resource: model.Resource{ID: "1"}}: makeEntries(350),
+	}
+
+	results, resCount := plugin.WriteAll(keyToEntries)
+	waitResults(t, results, resCount)
+
+	assert.Equal(t, 4, len(client.requests))
+	for i, req := range client.requests {
+		assert.Equal(t, strconv.Itoa(i*100), req.Entries[0].Message)
+	}
+}
+
+func TestBatchGroups_Success(t *testing.T) {
+	keyToEntries := map[model.BatchKey][]*model.Entry{
+		{Resource: model.Resource{ID: "1"}, StreamName: "a"}: makeEntries(150),
+		{Resource: model.Resource{ID: "1"}, StreamName: "b"}: makeEntries(10),
+		{Resource: model.Resource{ID: "2"}}:                  makeEntries(10),
+	}
+
+	parallel := (&Plugin{}).batchGroups(keyToEntries, 100)
+	ordered := (&Plugin{writeOpts: writeOptions{preserveOrder: true}}).batchGroups(keyToEntries, 100)
+
+	assert.Equal(t, 4, len(parallel))
+	assert.Equal(t, 2, len(ordered))
+	assert.Equal(t, 3, len(ordered[0]))
+	assert.Equal(t, "a", ordered[0][0].key.StreamName)
+	assert.Equal(t, 100, len(ordered[0][0].entries))
+	assert.Equal(t, "a", ordered[0][1].key.StreamName)
+	assert.Equal(t, "b", ordered[0][2].key.StreamName)
+	assert.Equal(t, 1, len(ordered[1]))
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
 
 	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/plugin"
 	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/test"
@@ -46,27 +47,24 @@ func TestPlugin_Success(t *testing.T) {
 		{"type": "1", "id": "1", "name": 10, "metadata_message": "message_10", "metadata_level": "ERROR"},
 		{"type": "2", "id": "2", "name": 20, "metadata_message": "message_20", "metadata_level": "WARN"},
 	}
-	var cur uint64
-	recordProvider := func() (ret int, ts interface{}, rec map[interface{}]interface{}) {
-		if int(cur) >= len(records) {
-			return 1, nil, nil
-		}
-		cur++
-		return 0, cur - 1, records[cur-1]
+	var chunk []byte
+	encoder := codec.NewEncoderBytes(&chunk, &codec.MsgpackHandle{})
+	for i, record := range records {
+		assert.Nil(t, encoder.Encode([]interface{}{uint64(i), record}))
 	}
 
-	resourceToEntries := impl.Transform(recordProvider, "tag")
+	keyToEntries := impl.TransformMsgpack(chunk, "tag")
 
-	assert.NotNil(t, resourceToEntries)
-	assert.Equal(t, 2, len(resourceToEntries))
+	assert.NotNil(t, keyToEntries)
+	assert.Equal(t, 2, len(keyToEntries))
 	types := make([]string, 0)
-	for res := range resourceToEntries {
-		types = append(types, res.Type)
+	for key := range keyToEntries {
+		types = append(types, key.Resource.Type)
 	}
 	sort.Strings(types)
 	assert.Equal(t, []string{"1_type", "2_type"}, types)
-	for resource, entries := range resourceToEntries {
-		resource := resource
+	for key, entries := range keyToEntries {
+		resource := key.Resource
 		switch resource.Type {
 		case "1_type":
 			assert.Equal(t, "1_id", resource.ID)
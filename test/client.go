@@ -24,3 +24,8 @@ func (c *Client) Init(authorization string, endpoint string, CAFileName string)
 	_ = CAFileName
 	return nil
 }
+
+func (c *Client) Close(ctx context.Context) error {
+	_ = ctx
+	return nil
+}
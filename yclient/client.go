@@ -34,6 +34,9 @@ type client struct {
 
 	destination *logging.Destination
 	defaults    *logging.LogEntryDefaults
+	compression string
+	// hoistCommonFields moves payload fields shared by all entries of request to its defaults
+	hoistCommonFields bool
 }
 
 func (c *client) Write(ctx context.Context, req *model.WriteRequest, opts ...grpc.CallOption) (map[int64]*status.Status, error) {
@@ -41,6 +44,9 @@ func (c *client) Write(ctx context.Context, req *model.WriteRequest, opts ...grp
 	defer c.mu.RUnlock()
 
 	in := c.loggingWriteRequest(req)
+	if len(c.compression) > 0 {
+		opts = append(opts, grpc.UseCompressor(c.compression))
+	}
 	res, err := c.writer.Write(ctx, in, opts...)
 	if err != nil {
 		return nil, err
@@ -101,6 +107,19 @@ func (c *client) closeSDK() {
 	}()
 }
 
+// Close shuts down SDK, waiting for its connections to be closed until ctx is done.
+func (c *client) Close(ctx context.Context) error {
+	c.mu.Lock()
+	sdk := c.sdk
+	c.sdk = nil
+	c.mu.Unlock()
+
+	if sdk == nil {
+		return nil
+	}
+	return sdk.Shutdown(ctx)
+}
+
 func (c *client) loggingWriteRequest(req *model.WriteRequest) *logging.WriteRequest {
 	var resource *logging.LogEntryResource
 	if len(req.Resource.Type) > 0 || len(req.Resource.ID) > 0 {
@@ -122,16 +141,28 @@ func (c *client) loggingWriteRequest(req *model.WriteRequest) *logging.WriteRequ
 		})
 	}
 
+	destination := c.destination
+	if req.Destination != nil {
+		destination = loggingDestination(req.Destination)
+	}
+
+	defaults := c.defaults
+	if c.hoistCommonFields {
+		defaults = hoistCommonFields(entries, defaults)
+	}
+
 	return &logging.WriteRequest{
-		Destination: c.destination,
+		Destination: destination,
 		Resource:    resource,
 		Entries:     entries,
-		Defaults:    c.defaults,
+		Defaults:    defaults,
 	}
 }
 
-func New(destination *model.Destination, defaults *model.Defaults, authorization string, endpoint string, CAFileName string) (client2.Client, error) {
+func New(destination *model.Destination, defaults *model.Defaults, authorization string, endpoint string, CAFileName string, compression string, hoistCommonFields bool) (client2.Client, error) {
 	c := new(client)
+	c.compression = compression
+	c.hoistCommonFields = hoistCommonFields
 
 	c.destination = loggingDestination(destination)
 	loggingDefaults, err := logEntryDefaults(defaults)
@@ -0,0 +1,75 @@
+package yclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/logging/v1"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/config"
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/plugin"
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/test"
+)
+
+// recordingClient keeps requests converted by client instead of sending them.
+type recordingClient struct {
+	test.Client
+	client   *client
+	requests []*logging.WriteRequest
+}
+
+func (c *recordingClient) Write(_ context.Context, in *model.WriteRequest, _ ...grpc.CallOption) (map[int64]*status.Status, error) {
+	c.requests = append(c.requests, c.client.loggingWriteRequest(in))
+	return nil, nil
+}
+
+func TestWrite_PayloadKey_DefaultPayload_Success(t *testing.T) {
+	configMap := map[string]string{
+		"message_key":     "message",
+		"payload_key":     "fields",
+		"default_payload": `{"service": "default", "fields": {"env": "prod"}}`,
+	}
+	getConfigValue := func(key string) string {
+		return configMap[key]
+	}
+	defaults, err := config.GetDefaults(getConfigValue, test.MetadataProvider{})
+	assert.Nil(t, err)
+	loggingDefaults, err := logEntryDefaults(defaults)
+	assert.Nil(t, err)
+	recording := &recordingClient{client: &client{defaults: loggingDefaults, hoistCommonFields: true}}
+	p, err := plugin.New(getConfigValue, test.MetadataProvider{}, recording)
+	assert.Nil(t, err)
+
+	records := []map[interface{}]interface{}{
+		{"message": "first", "service": "record"},
+		{"message": "second", "service": "record"},
+	}
+	var chunk []byte
+	encoder := codec.NewEncoderBytes(&chunk, &codec.MsgpackHandle{})
+	for _, record := range records {
+		assert.Nil(t, encoder.Encode([]interface{}{uint64(1688206830), record}))
+	}
+	keyToEntries := p.TransformMsgpack(chunk, "tag")
+	p.Flush(keyToEntries)
+	p.Close()
+
+	assert.Equal(t, 1, len(recording.requests))
+	req := recording.requests[0]
+	// default fields are kept, common payload_key field isn't hoisted since Cloud Logging
+	// replaces default value of the same key with the entry one rather than merging them
+	assert.Equal(t, map[string]interface{}{
+		"service": "default",
+		"fields":  map[string]interface{}{"env": "prod"},
+	}, req.Defaults.JsonPayload.AsMap())
+	assert.Equal(t, 2, len(req.Entries))
+	for _, entry := range req.Entries {
+		assert.Equal(t, map[string]interface{}{
+			"fields": map[string]interface{}{"service": "record"},
+		}, entry.JsonPayload.AsMap())
+	}
+}
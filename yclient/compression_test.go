@@ -0,0 +1,120 @@
+package yclient
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
+)
+
+// loadCorpus reads sample container logs, one JSON record per line.
+func loadCorpus(tb testing.TB) []*model.Entry {
+	file, err := os.Open("testdata/corpus.jsonl")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer file.Close()
+
+	entries := make([]*model.Entry, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		payload := new(structpb.Struct)
+		if err := payload.UnmarshalJSON(scanner.Bytes()); err != nil {
+			tb.Fatal(err)
+		}
+		message := payload.Fields["log"].GetStringValue()
+		delete(payload.Fields, "log")
+		entries = append(entries, &model.Entry{
+			Timestamp:   time.Unix(1688205600, 0),
+			Message:     message,
+			JSONPayload: payload,
+		})
+	}
+	return entries
+}
+
+func marshalCorpus(tb testing.TB) []byte {
+	c := &client{destination: loggingDestination(&model.Destination{LogGroupID: "group"})}
+	in := c.loggingWriteRequest(&model.WriteRequest{
+		Resource: &model.Resource{Type: "k8s", ID: "cluster"},
+		Entries:  loadCorpus(tb),
+	})
+	// deterministic order of Struct fields keeps compressed size stable between runs
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(in)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+func compress(tb testing.TB, name string, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := encoding.GetCompressor(name).Compress(&buf)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		tb.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompressors_Success(t *testing.T) {
+	data := marshalCorpus(t)
+
+	for _, name := range []string{"gzip", zstdName} {
+		compressor := encoding.GetCompressor(name)
+		assert.NotNil(t, compressor, name)
+
+		// the second round checks pooled encoders
+		for i := 0; i < 2; i++ {
+			compressed := compress(t, name, data)
+			assert.Less(t, len(compressed), len(data)/4, name)
+
+			r, err := compressor.Decompress(bytes.NewReader(compressed))
+			assert.Nil(t, err)
+			decompressed, err := io.ReadAll(r)
+			assert.Nil(t, err)
+			assert.Equal(t, data, decompressed)
+		}
+	}
+}
+
+// BenchmarkCompression reports bytes on wire for WriteRequest with sample corpus,
+// i.e. go test ./yclient -run=^$ -bench=Compression
+func BenchmarkCompression(b *testing.B) {
+	data := marshalCorpus(b)
+
+	b.Run("none", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = append([]byte(nil), data...)
+		}
+		b.ReportMetric(float64(len(data)), "wire-bytes")
+		b.ReportMetric(1, "ratio")
+	})
+	for _, name := range []string{"gzip", zstdName} {
+		name := name
+		b.Run(name, func(b *testing.B) {
+			var compressed []byte
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				compressed = compress(b, name, data)
+			}
+			b.ReportMetric(float64(len(compressed)), "wire-bytes")
+			b.ReportMetric(float64(len(data))/float64(len(compressed)), "ratio")
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"strings"
 
 	"github.com/yandex-cloud/go-genproto/yandex/cloud/logging/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/model"
 )
@@ -50,3 +52,57 @@ func logEntryDefaults(from *model.Defaults) (*logging.LogEntryDefaults, error) {
 
 	return defaults, nil
 }
+
+// hoistCommonFields moves payload fields equal in all entries to defaults payload, merging them with configured one.
+// Entries payloads are replaced with copies, so that original structs stay untouched.
+func hoistCommonFields(entries []*logging.IncomingLogEntry, defaults *logging.LogEntryDefaults) *logging.LogEntryDefaults {
+	if len(entries) < 2 {
+		return defaults
+	}
+
+	// fields of configured defaults are not hoisted, since they may be merged with entry values
+	common := make(map[string]*structpb.Value)
+	for key, value := range entries[0].GetJsonPayload().GetFields() {
+		if _, ok := defaults.GetJsonPayload().GetFields()[key]; !ok {
+			common[key] = value
+		}
+	}
+	if len(common) == 0 {
+		return defaults
+	}
+	for _, entry := range entries[1:] {
+		fields := entry.GetJsonPayload().GetFields()
+		for key, value := range common {
+			if other, ok := fields[key]; !ok || !proto.Equal(value, other) {
+				delete(common, key)
+			}
+		}
+		if len(common) == 0 {
+			return defaults
+		}
+	}
+
+	for _, entry := range entries {
+		fields := make(map[string]*structpb.Value, len(entry.JsonPayload.Fields)-len(common))
+		for key, value := range entry.JsonPayload.Fields {
+			if _, ok := common[key]; !ok {
+				fields[key] = value
+			}
+		}
+		entry.JsonPayload = nil
+		if len(fields) > 0 {
+			entry.JsonPayload = &structpb.Struct{Fields: fields}
+		}
+	}
+
+	// the rest of defaults, i.e. stream name, is kept as is
+	hoisted := &logging.LogEntryDefaults{}
+	if defaults != nil {
+		hoisted = proto.Clone(defaults).(*logging.LogEntryDefaults)
+	}
+	hoisted.JsonPayload = &structpb.Struct{Fields: common}
+	for key, value := range defaults.GetJsonPayload().GetFields() {
+		common[key] = value
+	}
+	return hoisted
+}
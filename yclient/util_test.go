@@ -0,0 +1,76 @@
+package yclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/logging/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func mustStruct(fields map[string]interface{}) *structpb.Struct {
+	s, err := structpb.NewStruct(fields)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func TestHoistCommonFields_Success(t *testing.T) {
+	payload1 := mustStruct(map[string]interface{}{"host": "h1", "pod": "p1", "n": 1, "cluster": "c"})
+	payload2 := mustStruct(map[string]interface{}{"host": "h1", "pod": "p1", "n": 2, "cluster": "c"})
+	entries := []*logging.IncomingLogEntry{
+		{Message: "1", JsonPayload: payload1},
+		{Message: "2", JsonPayload: payload2},
+	}
+	defaults := &logging.LogEntryDefaults{
+		Level:       logging.LogLevel_INFO,
+		JsonPayload: mustStruct(map[string]interface{}{"env": "prod", "cluster": "default"}),
+		StreamName:  "stream",
+	}
+
+	hoisted := hoistCommonFields(entries, defaults)
+
+	assert.Equal(t, logging.LogLevel_INFO, hoisted.Level)
+	assert.Equal(t, "stream", hoisted.StreamName)
+	assert.Equal(t, map[string]interface{}{"host": "h1", "pod": "p1", "env": "prod", "cluster": "default"}, hoisted.JsonPayload.AsMap())
+	assert.Equal(t, map[string]interface{}{"n": float64(1), "cluster": "c"}, entries[0].JsonPayload.AsMap())
+	assert.Equal(t, map[string]interface{}{"n": float64(2), "cluster": "c"}, entries[1].JsonPayload.AsMap())
+	// original payloads and defaults are untouched
+	assert.Equal(t, 4, len(payload1.Fields))
+	assert.Equal(t, 2, len(defaults.JsonPayload.Fields))
+}
+
+func TestHoistCommonFields_AllFields_Success(t *testing.T) {
+	entries := []*logging.IncomingLogEntry{
+		{JsonPayload: mustStruct(map[string]interface{}{"host": "h1"})},
+		{JsonPayload: mustStruct(map[string]interface{}{"host": "h1"})},
+	}
+
+	hoisted := hoistCommonFields(entries, nil)
+
+	assert.Equal(t, map[string]interface{}{"host": "h1"}, hoisted.JsonPayload.AsMap())
+	assert.Nil(t, entries[0].JsonPayload)
+	assert.Nil(t, entries[1].JsonPayload)
+}
+
+func TestHoistCommonFields_NoCommon_Success(t *testing.T) {
+	defaults := &logging.LogEntryDefaults{Level: logging.LogLevel_WARN}
+	tests := [][]*logging.IncomingLogEntry{
+		{{JsonPayload: mustStruct(map[string]interface{}{"host": "h1"})}},
+		{
+			{JsonPayload: mustStruct(map[string]interface{}{"host": "h1"})},
+			{JsonPayload: mustStruct(map[string]interface{}{"host": "h2"})},
+		},
+		{
+			{JsonPayload: mustStruct(map[string]interface{}{"host": "h1"})},
+			{},
+		},
+	}
+	for _, entries := range tests {
+		hoisted := hoistCommonFields(entries, defaults)
+
+		assert.Equal(t, defaults, hoisted)
+		assert.Equal(t, "h1", entries[0].JsonPayload.AsMap()["host"])
+	}
+}
@@ -7,8 +7,6 @@ import (
 
 	"github.com/fluent/fluent-bit-go/output"
 	ycsdk "github.com/yandex-cloud/go-sdk"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 
 	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/config"
 	"github.com/yandex-cloud/fluent-bit-plugin-yandex/v2/metadata"
@@ -31,8 +29,9 @@ func FLBPluginInit(plugin unsafe.Pointer) int {
 	}
 	metadataProvider := metadata.NewCachingProvider(ycsdk.InstanceMetadataAddr)
 
-	destination, err := config.GetDestination(getConfigValue, metadataProvider)
+	destination, err := config.GetDestination(getConfigValue, metadataProvider, plugin2.ParseGroupID)
 	if err != nil {
+		fmt.Printf("yc-logging: init err: %s\n", err.Error())
 		return output.FLB_ERROR
 	}
 	defaults, err := config.GetDefaults(getConfigValue, metadataProvider)
@@ -46,8 +45,19 @@ func FLBPluginInit(plugin unsafe.Pointer) int {
 	}
 	endpoint := config.GetEndpoint(getConfigValue)
 	CAFileName := config.GetCAFileName(getConfigValue)
+	compression, err := config.GetCompression(getConfigValue)
+	if err != nil {
+		fmt.Printf("yc-logging: init err: %s\n", err.Error())
+		return output.FLB_ERROR
+	}
 
-	ingestionClient, err := yclient.New(destination, defaults, authorization, endpoint, CAFileName)
+	hoistCommonFields, err := config.GetHoistCommonFields(getConfigValue)
+	if err != nil {
+		fmt.Printf("yc-logging: init err: %s\n", err.Error())
+		return output.FLB_ERROR
+	}
+
+	ingestionClient, err := yclient.New(destination, defaults, authorization, endpoint, CAFileName, compression, hoistCommonFields)
 	if err != nil {
 		return output.FLB_ERROR
 	}
@@ -68,42 +78,11 @@ func FLBPluginFlushCtx(ctx, data unsafe.Pointer, length C.int, tag *C.char) int
 
 	plugin := output.FLBPluginGetContext(ctx).(*plugin2.Plugin)
 
-	dec := output.NewDecoder(data, int(length))
-	provider := func() (ret int, ts interface{}, rec map[interface{}]interface{}) {
-		return output.GetRecord(dec)
-	}
-	resourceToEntries := plugin.Transform(provider, tagStr)
-
-	results, resCount := plugin.WriteAll(resourceToEntries)
-
-	for i := 0; i < resCount; i++ {
-		err := <-results
-		if err == nil {
-			continue
-		}
-
-		code := status.Code(err)
-		switch code {
-		case codes.PermissionDenied:
-			// kick client reinit
-			fmt.Printf("yc-logging: reinit on write error %s: %q\n", code.String(), err.Error())
-			if initErr := plugin.InitClient(); initErr != nil {
-				fmt.Printf("yc-logging: reinit failed: %q\n", initErr.Error())
-			} else {
-				fmt.Printf("yc-logging: reinit succeded\n")
-			}
-			return output.FLB_RETRY
-		case codes.ResourceExhausted, codes.FailedPrecondition, codes.Unavailable,
-			codes.Canceled, codes.DeadlineExceeded:
-			fmt.Printf("yc-logging: write retriable error %s: %q\n", code.String(), err.Error())
-			return output.FLB_RETRY
-		default:
-			fmt.Printf("yc-logging: write failed %s: %q\n", code.String(), err.Error())
-			return output.FLB_ERROR
-		}
-	}
+	// chunk is only read during the call, so it isn't copied
+	chunk := unsafe.Slice((*byte)(data), int(length))
+	keyToEntries := plugin.TransformMsgpack(chunk, tagStr)
 
-	return output.FLB_OK
+	return plugin.Flush(keyToEntries)
 }
 
 //export FLBPluginExit
@@ -111,5 +90,12 @@ func FLBPluginExit() int {
 	return output.FLB_OK
 }
 
+//export FLBPluginExitCtx
+func FLBPluginExitCtx(ctx unsafe.Pointer) int {
+	plugin := output.FLBPluginGetContext(ctx).(*plugin2.Plugin)
+	plugin.Close()
+	return output.FLB_OK
+}
+
 func main() {
 }